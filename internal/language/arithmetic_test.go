@@ -0,0 +1,79 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestIntArithmetic(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[int-add 1 2 3]", "int<6>"},
+		{"[int-subtract 10 1 2]", "int<7>"},
+		{"[int-multiply 2 3 4]", "int<24>"},
+		{"[int-multiply]", "int<1>"},
+		{"[int-multiply 9223372036854775807 2]", "int<-2>"},
+		{"[int-add 9223372036854775807 1]", "int<-9223372036854775808>"},
+		{"[int-divide -9223372036854775808 -1]", "ok<int<-9223372036854775808>>"},
+		{"[int-remainder 7 3]", "ok<int<1>>"},
+		{"[int-remainder -7 3]", "ok<int<-1>>"},
+		{"[int-remainder 7 0]", "error<string<division by zero>>"},
+		{"[int-remainder -9223372036854775808 -1]", "ok<int<0>>"},
+		{"[int-negate 5]", "int<-5>"},
+		{"[int-negate -9223372036854775808]", "int<-9223372036854775808>"},
+		{"[int-abs -5]", "int<5>"},
+		{"[int-abs 5]", "int<5>"},
+		{"[int-min 3 1 2]", "int<1>"},
+		{"[int-max 3 1 2]", "int<3>"},
+		{"[int-max 4]", "int<4>"},
+		{"[int-and 12 10]", "int<8>"},
+		{"[int-and]", "int<-1>"},
+		{"[int-or 12 10 1]", "int<15>"},
+		{"[int-xor 12 10]", "int<6>"},
+		{"[int-shift-left 1 7]", "int<128>"},
+		{"[int-shift-left 1 64]", "int<0>"},
+		{"[int-shift-right 128 7]", "int<1>"},
+		{"[int-shift-right -8 1]", "int<-4>"},
+		{"[int-shift-right -1 64]", "int<-1>"},
+		{"[int-or [int-shift-left 1 3] [int-shift-left 1 0]]", "int<9>"},
+		{"[int-equal 2 2]", "bool<true>"},
+		{"[int-equal 2 3]", "bool<false>"},
+		{"[int-less 2 3]", "bool<true>"},
+		{"[int-less 3 3]", "bool<false>"},
+		{"[int-greater 3 2]", "bool<true>"},
+		{"[int-greater -1 0]", "bool<false>"},
+		{"[if [int-greater 1 0] 'positive' 'other']", "string<positive>"},
+	}
+
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	for _, test := range tests {
+		for _, result := range []Value{evaluateOrFail(test.input, env, t), runOrFail(test.input, env, t)} {
+			if valueToString(result) != test.expected {
+				t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[int-multiply 2 'three']", "<test>:1:1 arguments to int-multiply must be integers"},
+		{"[int-negate 1 2]", "<test>:1:1 int-negate requires 1 argument"},
+		{"[int-min]", "<test>:1:1 int-min requires at least 1 argument"},
+		{"[int-equal 1]", "<test>:1:1 int-equal requires 2 arguments"},
+		{"[int-shift-left 1 -1]", "<test>:1:1 amount to int-shift-left must not be negative"},
+		{"[int-divide 1]", "<test>:1:1 int-divide requires 2 arguments"},
+		{"[int-parse 1]", "<test>:1:1 argument to int-parse must be a string"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
@@ -4,279 +4,1053 @@ import (
 	"errors"
 )
 
-func AddBuiltins(
-	env *Environment,
-) {
-	env.Set("define", Value{
-		Type: Function,
-		Data: func(
-			args []Value,
-			env *Environment,
-		) (
-			Value,
-			error,
-		) {
-			// [define symbol expression]
-			if len(args) != 2 {
-				return Value{}, errors.New("define requires 2 arguments")
-			}
-			symbolValue := args[0]
-			if symbolValue.Type != Symbol {
-				return Value{}, errors.New("first argument to define must be a symbol")
-			}
-			result, err := Evaluate(args[1], env)
-			if err != nil {
-				return Value{}, err
-			}
-			env.Set(symbolValue.Data.(string), result)
-			return result, nil
-		},
-	})
+// builtin is a value AddBuiltins defines, together with what the checker, the inference and the compiler need to know about it.
+type builtin struct {
+	Value Value
+	// Arity is the minimum and maximum number of arguments of a function, a maximum of -1 means there is no maximum.
+	Arity [2]int
+	// Type returns the signature the inference gives the function, with type variables created by fresh so each use gets its own. Special forms, which do not evaluate their arguments like a call, have none and are typed by the inference itself.
+	Type func(fresh func() *Type) builtinType
+	// Compiled is set for the functions the compiler turns into instructions of their own rather than calls.
+	Compiled bool
+	// Quoted reports which arguments the function takes as they are written, which the virtual machine passes without evaluating them.
+	Quoted func(index int) bool
+}
 
-	env.Set("function", Value{
-		Type: Function,
-		Data: func(
-			args []Value,
-			env *Environment,
-		) (Value, error) {
-			// [function [parameters] body]
-			if len(args) != 2 {
-				return Value{}, errors.New("function requires 2 arguments")
-			}
+// builtins are the values AddBuiltins defines. They are created in init, as evaluating an import adds them to the environment of the module.
+var builtins map[string]builtin
 
-			parametersValue := args[0]
-			if parametersValue.Type != List {
-				return Value{}, errors.New("function parameters must be a list")
-			}
+func init() {
+	builtins = map[string]builtin{
+		"define": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					// [define symbol expression]
+					if len(args) != 2 {
+						return Value{}, errors.New("define requires 2 arguments")
+					}
+					symbolValue := args[0]
+					if symbolValue.Type != Symbol {
+						return Value{}, errors.New("first argument to define must be a symbol")
+					}
+					result, err := evaluateStatement(args[1], env)
+					if err != nil {
+						return Value{}, err
+					}
+					defineValue(symbolValue.Data.(string), result, env)
+					return result, nil
+				},
+			},
+			Arity:    [2]int{2, 2},
+			Compiled: true,
+		},
 
-			parameterList := parametersValue.Data.([]Value)
-			var parameters []string
-			for _, parameter := range parameterList {
-				if parameter.Type != Symbol {
-					return Value{}, errors.New("function parameters must be symbols")
-				}
-				parameters = append(parameters, parameter.Data.(string))
-			}
+		"function": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (Value, error) {
+					// [function type? [type? parameter ... when? guard?] body]
+					returnType, rest, err := parseReturnType("function", args)
+					if err != nil {
+						return Value{}, err
+					}
+					site := args[0].Position
+					args = rest
 
-			body := args[1]
+					parameters, guard, err := parseParameters("function", args[0])
+					if err != nil {
+						return Value{}, err
+					}
+					definition := signatureToString("function", returnType, parameters, guard)
+					returnCheck := ReturnCheck{
+						Type:       returnType,
+						Definition: definition,
+						Position:   site,
+					}
 
-			function := func(
-				callArgs []Value,
-				callEnv *Environment,
-			) (Value, error) {
-				if len(callArgs) != len(parameters) {
-					return Value{}, errors.New("incorrect number of arguments")
-				}
-				innerEnv := NewEnv(env)
-				for index, parameter := range parameters {
-					if callArgs[index].Type == List {
-						innerEnv.Set(parameter, Value{
+					body := args[1]
+					// A call of the function to itself in tail position evaluates its untyped arguments before the call, so an accumulator does not build up a chain of thunks.
+					tailCalls := make(map[*Value]bool)
+					tailCallArguments(body, tailCalls)
+
+					function := func(
+						callArgs []Value,
+						callEnv *Environment,
+					) (Value, error) {
+						if len(callArgs) != len(parameters) {
+							return Value{}, errors.New("incorrect number of arguments")
+						}
+						innerEnv := newCallEnv(env, callEnv)
+						selfCall := len(callArgs) > 0 && tailCalls[&callArgs[0]]
+						for index, parameter := range parameters {
+							if parameter.Type == Unknown && selfCall {
+								callArg, err := EvaluateUntilConcrete(
+									callArgs[index],
+									callEnv,
+								)
+								if err != nil {
+									return Value{}, err
+								}
+								innerEnv.Set(parameter.Name, callArg)
+							} else if parameter.Type != Unknown {
+								// Typed parameters need to be evaluated to check their type.
+								callArg, err := EvaluateUntilConcrete(
+									callArgs[index],
+									callEnv,
+								)
+								if err != nil {
+									return Value{}, err
+								}
+								if err := checkParameter(parameter, callArg); err != nil {
+									return Value{}, err
+								}
+								innerEnv.Set(parameter.Name, callArg)
+							} else if callArgs[index].Type == List || callArgs[index].Type == Symbol {
+								innerEnv.Set(parameter.Name, Value{
+									Type: Lazy,
+									Data: &LazyData{
+										Expression:  callArgs[index],
+										Environment: callEnv,
+									},
+								})
+							} else {
+								innerEnv.Set(parameter.Name, callArgs[index])
+							}
+						}
+						if err := checkGuard(guard, innerEnv, definition); err != nil {
+							return Value{}, err
+						}
+						return Value{
 							Type: Lazy,
-							Data: LazyData{
-								Expression:  callArgs[index],
-								Environment: callEnv,
+							Data: &LazyData{
+								Expression:  body,
+								Environment: innerEnv,
+								Return:      returnCheck,
+								Transient:   true,
 							},
-						})
-					} else {
-						innerEnv.Set(parameter, callArgs[index])
+						}, nil
 					}
-				}
-				return Value{
-					Type: Lazy,
-					Data: LazyData{
-						Expression:  body,
-						Environment: innerEnv,
-					},
-				}, nil
-			}
-			return Value{
-				Type: Function,
-				Data: function,
-			}, nil
+					return Value{
+						Type: Function,
+						Data: FunctionData{
+							Parameters: parameters,
+							Guard:      guard,
+							ReturnType: returnType,
+							Definition: definition,
+							Call:       function,
+						},
+					}, nil
+				},
+			},
+			Arity:    [2]int{2, 3},
+			Compiled: true,
 		},
-	})
 
-	env.Set("procedure", Value{
-		Type: Function,
-		Data: func(
-			args []Value,
-			env *Environment,
-		) (Value, error) {
-			// [procedure [parameters] body]
-			if len(args) != 2 {
-				return Value{}, errors.New("procedure requires 2 arguments")
-			}
+		"procedure": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (Value, error) {
+					// [procedure type? [type? parameter ... when? guard?] body]
+					returnType, rest, err := parseReturnType("procedure", args)
+					if err != nil {
+						return Value{}, err
+					}
+					site := args[0].Position
+					args = rest
 
-			parametersValue := args[0]
-			if parametersValue.Type != List {
-				return Value{}, errors.New("procedure parameters must be a list")
-			}
+					parameters, guard, err := parseParameters("procedure", args[0])
+					if err != nil {
+						return Value{}, err
+					}
+					definition := signatureToString("procedure", returnType, parameters, guard)
+					returnCheck := ReturnCheck{
+						Type:       returnType,
+						Definition: definition,
+						Position:   site,
+					}
 
-			parameterList := parametersValue.Data.([]Value)
-			var parameters []string
-			for _, parameter := range parameterList {
-				if parameter.Type != Symbol {
-					return Value{}, errors.New("procedure parameters must be symbols")
-				}
-				parameters = append(parameters, parameter.Data.(string))
-			}
+					body := args[1]
 
-			body := args[1]
+					procedure := func(
+						callArgs []Value,
+						callEnv *Environment,
+					) (Value, error) {
+						if len(callArgs) != len(parameters) {
+							return Value{}, errors.New("incorrect number of arguments")
+						}
+						innerEnv := newCallEnv(env, callEnv)
+						for index, parameter := range parameters {
+							callArg, err := EvaluateUntilConcrete(
+								callArgs[index],
+								callEnv,
+							)
+							if err != nil {
+								return Value{}, err
+							}
+							if err := checkParameter(parameter, callArg); err != nil {
+								return Value{}, err
+							}
+							innerEnv.Set(parameter.Name, callArg)
+						}
+						if err := checkGuard(guard, innerEnv, definition); err != nil {
+							return Value{}, err
+						}
+						// Like a function, the body is left to the caller to evaluate so calls in tail position do not nest.
+						return Value{
+							Type: Lazy,
+							Data: &LazyData{
+								Expression:  body,
+								Environment: innerEnv,
+								Return:      returnCheck,
+								Procedure:   true,
+								Transient:   true,
+							},
+						}, nil
+					}
 
-			procedure := func(
-				callArgs []Value,
-				callEnv *Environment,
-			) (Value, error) {
-				if len(callArgs) != len(parameters) {
-					return Value{}, errors.New("incorrect number of arguments")
-				}
-				innerEnv := NewEnv(env)
-				for index, parameter := range parameters {
-					callArg, err := EvaluateUntilConcrete(
-						callArgs[index],
-						callEnv,
-					)
+					return Value{
+						Type: Procedure,
+						Data: FunctionData{
+							Parameters: parameters,
+							Guard:      guard,
+							ReturnType: returnType,
+							Definition: definition,
+							Call:       procedure,
+						},
+					}, nil
+				},
+			},
+			Arity:    [2]int{2, 3},
+			Compiled: true,
+		},
+
+		"if": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					// [if condition then else?]
+					if len(args) != 2 && len(args) != 3 {
+						return Value{}, errors.New("if requires 2 or 3 arguments")
+					}
+					condition, err := EvaluateUntilConcrete(args[0], env)
 					if err != nil {
 						return Value{}, err
 					}
-					innerEnv.Set(parameter, callArg)
-				}
-				return Evaluate(body, innerEnv)
-			}
+					thenExpression := args[1]
+					var elseExpression Value
+					if len(args) == 3 {
+						elseExpression = args[2]
+					} else {
+						elseExpression = Value{
+							Type: Option,
+							Data: OptionValue{
+								Some: false,
+							},
+						}
+					}
+					if !isTruthy(condition) {
+						return Evaluate(elseExpression, env)
+					}
+					return Evaluate(thenExpression, env)
+				},
+			},
+			Arity:    [2]int{2, 3},
+			Compiled: true,
+		},
 
-			return Value{
-				Type: Procedure,
-				Data: procedure,
-			}, nil
+		"and": {
+			Value: logicalOperator("and", false),
+			Arity: [2]int{0, -1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Variadic: namedType("any"), Result: namedType("bool")}
+			},
+			Compiled: true,
+		},
+		"or": {
+			Value: logicalOperator("or", true),
+			Arity: [2]int{0, -1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Variadic: namedType("any"), Result: namedType("bool")}
+			},
+			Compiled: true,
 		},
-	})
 
-	env.Set("if", Value{
-		Type: Function,
-		Data: func(
-			args []Value,
-			env *Environment,
-		) (
-			Value,
-			error,
-		) {
-			// [if condition then else?]
-			if len(args) != 2 && len(args) != 3 {
-				return Value{}, errors.New("if requires 2 or 3 arguments")
-			}
-			condition, err := EvaluateUntilConcrete(args[0], env)
-			if err != nil {
-				return Value{}, err
-			}
-			thenExpression := args[1]
-			var elseExpression Value
-			if len(args) == 3 {
-				elseExpression = args[2]
-			} else {
-				elseExpression = Value{
-					Type: Option,
-					Data: OptionValue{
-						Some: false,
-					},
-				}
-			}
-			// Only a bool or Option with Some == false is considered false.
-			if (condition.Type == Bool && !condition.Data.(bool)) || (condition.Type == Option && !condition.Data.(OptionValue).Some) {
-				return Evaluate(elseExpression, env)
-			}
-			return Evaluate(thenExpression, env)
+		"not": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					if len(args) != 1 {
+						return Value{}, errors.New("not requires 1 argument")
+					}
+					value, err := EvaluateUntilConcrete(args[0], env)
+					if err != nil {
+						return Value{}, err
+					}
+					return Value{
+						Type: Bool,
+						Data: !isTruthy(value),
+					}, nil
+				},
+			},
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("any")}, Result: namedType("bool")}
+			},
 		},
-	})
 
-	env.Set("match", Value{
-		Type: Function,
-		Data: func(
-			args []Value,
-			env *Environment,
-		) (
-			Value,
-			error,
-		) {
-			// [match expression [pattern result] [pattern result] ...]
-			if len(args) < 2 {
-				return Value{}, errors.New("match requires an expression and at least one clause")
-			}
-			matchValue, err := EvaluateUntilConcrete(args[0], env)
-			if err != nil {
-				return Value{}, err
-			}
+		"match": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					// [match expression [pattern result] [pattern result] ...]
+					if len(args) < 2 {
+						return Value{}, errors.New("match requires an expression and at least one clause")
+					}
+					matchValue, err := EvaluateUntilConcrete(args[0], env)
+					if err != nil {
+						return Value{}, err
+					}
 
-			var wildcard Value
-			for i := 1; i < len(args); i++ {
-				clause := args[i]
-				if clause.Type != List {
-					return Value{}, errors.New("each clause in match must be a list")
-				}
-				clauseList := clause.Data.([]Value)
-				if len(clauseList) != 2 {
-					return Value{}, errors.New("each clause in match must have exactly 2 elements")
-				}
-				pattern := clauseList[0]
-				resultExpression := clauseList[1]
+					var patterns []Value
+					for i := 1; i < len(args); i++ {
+						clause := args[i]
+						if clause.Type != List {
+							return Value{}, errors.New("each clause in match must be a list")
+						}
+						clauseList := clause.Data.([]Value)
+						if len(clauseList) != 2 {
+							return Value{}, errors.New("each clause in match must have exactly 2 elements")
+						}
+						patterns = append(patterns, clauseList[0])
+					}
+					if matchValue.Type == Option {
+						if err := checkOptionExhaustive(patterns); err != nil {
+							return Value{}, err
+						}
+					}
 
-				if pattern.Type == Symbol && pattern.Data.(string) == "_" {
-					// Grab wildcard pattern as fallback and store for later.
-					wildcard = resultExpression
-					continue
-				}
+					var wildcard Value
+					for i := 1; i < len(args); i++ {
+						clauseList := args[i].Data.([]Value)
+						pattern := clauseList[0]
+						resultExpression := clauseList[1]
 
-				patternValue, err := Evaluate(pattern, env)
-				if err != nil {
-					return Value{}, err
-				}
-				if valueEqual(matchValue, patternValue, env) {
-					return Evaluate(resultExpression, env)
-				}
-			}
+						if pattern.Type == Symbol && pattern.Data.(string) == "_" {
+							// Grab wildcard pattern as fallback and store for later.
+							wildcard = resultExpression
+							continue
+						}
 
-			if wildcard.Type != Unknown {
-				return Evaluate(wildcard, env)
-			}
+						// Each clause binds the symbols of its pattern in an environment of its own.
+						clauseEnv := NewEnv(env)
+						matched, err := matchPattern(pattern, matchValue, env, clauseEnv, false)
+						if err != nil {
+							return Value{}, err
+						}
+						if matched {
+							return Evaluate(resultExpression, clauseEnv)
+						}
+					}
 
-			return Value{
+					if wildcard.Type != Unknown {
+						return Evaluate(wildcard, env)
+					}
+
+					return Value{
+						Type: Option,
+						Data: OptionValue{
+							Some: false,
+						},
+					}, nil
+				},
+			},
+			Arity:    [2]int{2, -1},
+			Compiled: true,
+		},
+
+		// Option constructors.
+		"some": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					if len(args) != 1 {
+						return Value{}, errors.New("Some requires exactly one argument")
+					}
+					value, err := EvaluateUntilConcrete(args[0], env)
+					if err != nil {
+						return Value{}, err
+					}
+					return Value{
+						Type: Option,
+						Data: OptionValue{
+							Some:  true,
+							Value: value,
+						},
+					}, nil
+				},
+			},
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				value := fresh()
+				return builtinType{Parameters: []*Type{value}, Result: namedType("option", value)}
+			},
+		},
+		"none": {
+			Value: Value{
 				Type: Option,
 				Data: OptionValue{
 					Some: false,
 				},
-			}, nil
+			},
+		},
+
+		// Result constructors.
+		"ok": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					if len(args) != 1 {
+						return Value{}, errors.New("ok requires exactly one argument")
+					}
+					value, err := EvaluateUntilConcrete(args[0], env)
+					if err != nil {
+						return Value{}, err
+					}
+					return okValue(value), nil
+				},
+			},
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				value, err := fresh(), fresh()
+				return builtinType{Parameters: []*Type{value}, Result: resultType(value, err)}
+			},
+		},
+		"error": {
+			Value: Value{
+				Type: Function,
+				Data: func(
+					args []Value,
+					env *Environment,
+				) (
+					Value,
+					error,
+				) {
+					if len(args) != 1 {
+						return Value{}, errors.New("error requires exactly one argument")
+					}
+					value, err := EvaluateUntilConcrete(args[0], env)
+					if err != nil {
+						return Value{}, err
+					}
+					return Value{
+						Type: Result,
+						Data: ResultValue{
+							Ok:    false,
+							Value: value,
+						},
+					}, nil
+				},
+			},
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				value, err := fresh(), fresh()
+				return builtinType{Parameters: []*Type{err}, Result: resultType(value, err)}
+			},
+		},
+
+		// Structs.
+		"struct": {
+			Value:  defineStruct,
+			Arity:  [2]int{1, -1},
+			Quoted: func(int) bool { return true },
+		},
+		"struct-get": {
+			Value:  getStructField,
+			Arity:  [2]int{2, 2},
+			Quoted: func(index int) bool { return index == 1 },
+		},
+		"struct-set": {
+			Value:  setStructFields,
+			Arity:  [2]int{3, -1},
+			Quoted: func(index int) bool { return index%2 == 1 },
 		},
-	})
 
-	// Option constructors.
-	env.Set("some", Value{
+		// Arithmetic operators.
+		"int-add": {
+			Value:    addInts,
+			Arity:    [2]int{0, -1},
+			Type:     intVariadicType,
+			Compiled: true,
+		},
+		"int-subtract": {
+			Value:    subtractInts,
+			Arity:    [2]int{0, -1},
+			Type:     intVariadicType,
+			Compiled: true,
+		},
+		"int-divide": {
+			Value: divideInts,
+			Arity: [2]int{2, 2},
+			Type:  intDivisionType,
+		},
+		"int-parse": {
+			Value: parseInt,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("string")}, Result: resultType(namedType("int"), namedType("string"))}
+			},
+		},
+		"int-multiply": {
+			Value: multiplyInts,
+			Arity: [2]int{0, -1},
+			Type:  intVariadicType,
+		},
+		"int-remainder": {
+			Value: remainderInts,
+			Arity: [2]int{2, 2},
+			Type:  intDivisionType,
+		},
+		"int-negate": {
+			Value: negateInt,
+			Arity: [2]int{1, 1},
+			Type:  intFunctionType(1, "int"),
+		},
+		"int-abs": {
+			Value: absInt,
+			Arity: [2]int{1, 1},
+			Type:  intFunctionType(1, "int"),
+		},
+		"int-min": {
+			Value: minInts,
+			Arity: [2]int{1, -1},
+			Type:  intVariadicType,
+		},
+		"int-max": {
+			Value: maxInts,
+			Arity: [2]int{1, -1},
+			Type:  intVariadicType,
+		},
+		"int-and": {
+			Value: andInts,
+			Arity: [2]int{0, -1},
+			Type:  intVariadicType,
+		},
+		"int-or": {
+			Value: orInts,
+			Arity: [2]int{0, -1},
+			Type:  intVariadicType,
+		},
+		"int-xor": {
+			Value: xorInts,
+			Arity: [2]int{0, -1},
+			Type:  intVariadicType,
+		},
+		"int-shift-left": {
+			Value: shiftLeftInt,
+			Arity: [2]int{2, 2},
+			Type:  intFunctionType(2, "int"),
+		},
+		"int-shift-right": {
+			Value: shiftRightInt,
+			Arity: [2]int{2, 2},
+			Type:  intFunctionType(2, "int"),
+		},
+		"int-equal": {
+			Value: equalInts,
+			Arity: [2]int{2, 2},
+			Type:  intFunctionType(2, "bool"),
+		},
+		"int-less": {
+			Value: lessInts,
+			Arity: [2]int{2, 2},
+			Type:  intFunctionType(2, "bool"),
+		},
+		"int-greater": {
+			Value: greaterInts,
+			Arity: [2]int{2, 2},
+			Type:  intFunctionType(2, "bool"),
+		},
+		"list": {
+			Value: constructList,
+			Arity: [2]int{0, -1},
+			Type: func(fresh func() *Type) builtinType {
+				element := fresh()
+				return builtinType{Variadic: element, Result: namedType("list", element)}
+			},
+		},
+		"list-length": {
+			Value: listLength,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("list", fresh())}, Result: namedType("int")}
+			},
+		},
+		"list-get": {
+			Value: listGet,
+			Arity: [2]int{2, 2},
+			Type: func(fresh func() *Type) builtinType {
+				element := fresh()
+				return builtinType{Parameters: []*Type{namedType("list", element), namedType("int")}, Result: namedType("option", element)}
+			},
+		},
+		"list-prepend": {
+			Value: addToList("list-prepend", true),
+			Arity: [2]int{2, 2},
+			Type:  listAddType,
+		},
+		"list-append": {
+			Value: addToList("list-append", false),
+			Arity: [2]int{2, 2},
+			Type:  listAddType,
+		},
+		"list-slice": {
+			Value: listSlice,
+			Arity: [2]int{3, 3},
+			Type: func(fresh func() *Type) builtinType {
+				list := namedType("list", fresh())
+				return builtinType{Parameters: []*Type{list, namedType("int"), namedType("int")}, Result: resultType(list, namedType("string"))}
+			},
+		},
+		"list-concat": {
+			Value: concatenateLists,
+			Arity: [2]int{0, -1},
+			Type: func(fresh func() *Type) builtinType {
+				list := namedType("list", fresh())
+				return builtinType{Variadic: list, Result: list}
+			},
+		},
+		"fixed-add": {
+			Value: addFixeds,
+			Arity: [2]int{0, -1},
+			Type:  fixedVariadicType,
+		},
+		"fixed-subtract": {
+			Value: subtractFixeds,
+			Arity: [2]int{0, -1},
+			Type:  fixedVariadicType,
+		},
+		"fixed-multiply": {
+			Value: multiplyFixeds,
+			Arity: [2]int{0, -1},
+			Type:  fixedVariadicType,
+		},
+		"fixed-divide": {
+			Value: divideFixeds,
+			Arity: [2]int{2, 2},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("fixed"), namedType("fixed")}, Result: resultType(namedType("fixed"), namedType("string"))}
+			},
+		},
+		"fixed-sin": {
+			Value: sinFixed,
+			Arity: [2]int{1, 1},
+			Type:  fixedFunctionType(1),
+		},
+		"fixed-cos": {
+			Value: cosFixed,
+			Arity: [2]int{1, 1},
+			Type:  fixedFunctionType(1),
+		},
+		"fixed-atan2": {
+			Value: atan2Fixed,
+			Arity: [2]int{2, 2},
+			Type:  fixedFunctionType(2),
+		},
+		"int-to-fixed": {
+			Value: intToFixed,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("int")}, Result: namedType("fixed")}
+			},
+		},
+		"fixed-to-int": {
+			Value: fixedToInt,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("fixed")}, Result: namedType("int")}
+			},
+		},
+		"float-to-fixed": {
+			Value: floatToFixed,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("float")}, Result: namedType("fixed")}
+			},
+		},
+		"fixed-to-float": {
+			Value: fixedToFloat,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("fixed")}, Result: namedType("float")}
+			},
+		},
+		"float-add": {
+			Value: addFloats,
+			Arity: [2]int{0, -1},
+			Type:  floatVariadicType,
+		},
+		"float-subtract": {
+			Value: subtractFloats,
+			Arity: [2]int{0, -1},
+			Type:  floatVariadicType,
+		},
+		"float-multiply": {
+			Value: multiplyFloats,
+			Arity: [2]int{0, -1},
+			Type:  floatVariadicType,
+		},
+		"float-divide": {
+			Value: divideFloats,
+			Arity: [2]int{2, 2},
+			Type:  floatFunctionType(2),
+		},
+		"float-floor": {
+			Value: floorFloat,
+			Arity: [2]int{1, 1},
+			Type:  floatFunctionType(1),
+		},
+		"float-ceil": {
+			Value: ceilFloat,
+			Arity: [2]int{1, 1},
+			Type:  floatFunctionType(1),
+		},
+		"float-round": {
+			Value: roundFloat,
+			Arity: [2]int{1, 1},
+			Type:  floatFunctionType(1),
+		},
+		"float-sqrt": {
+			Value: sqrtFloat,
+			Arity: [2]int{1, 1},
+			Type:  floatFunctionType(1),
+		},
+		"float-sin": {
+			Value: sinFloat,
+			Arity: [2]int{1, 1},
+			Type:  floatFunctionType(1),
+		},
+		"float-cos": {
+			Value: cosFloat,
+			Arity: [2]int{1, 1},
+			Type:  floatFunctionType(1),
+		},
+		"float-atan2": {
+			Value: atan2Float,
+			Arity: [2]int{2, 2},
+			Type:  floatFunctionType(2),
+		},
+		"int-to-float": {
+			Value: intToFloat,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("int")}, Result: namedType("float")}
+			},
+		},
+		"float-to-int": {
+			Value: floatToInt,
+			Arity: [2]int{1, 1},
+			Type: func(fresh func() *Type) builtinType {
+				return builtinType{Parameters: []*Type{namedType("float")}, Result: namedType("int")}
+			},
+		},
+	}
+}
+
+// AddBuiltins defines the builtins in the environment.
+func AddBuiltins(
+	env *Environment,
+) {
+	for name, builtin := range builtins {
+		env.Set(name, builtin.Value)
+	}
+}
+
+// defineValue binds a value to a name in the environment. Functions of the same name with different parameters form an overload set.
+func defineValue(
+	name string,
+	value Value,
+	env *Environment,
+) {
+	if existing, ok := env.Values[name]; ok {
+		if overloaded, ok := overload(name, existing, value); ok {
+			env.Set(name, overloaded)
+			return
+		}
+	}
+	env.Set(name, value)
+}
+
+// parseReturnType parses the optional return type in front of the parameter list of a function or procedure. It returns the remaining parameter list and body.
+func parseReturnType(
+	kind string,
+	args []Value,
+) (
+	ValueType,
+	[]Value,
+	error,
+) {
+	if len(args) == 2 {
+		return Unknown, args, nil
+	}
+	if len(args) != 3 {
+		return Unknown, nil, errors.New(kind + " requires 2 or 3 arguments")
+	}
+	if args[0].Type != Symbol {
+		return Unknown, nil, errors.New(kind + " return type must be a type")
+	}
+	returnType, ok := parameterTypes[args[0].Data.(string)]
+	if !ok {
+		return Unknown, nil, errors.New(kind + " return type must be a type, got " + args[0].Data.(string))
+	}
+	return returnType, args[1:], nil
+}
+
+// tailCallArguments finds the calls in tail position of a function body, the body itself and the branches of an if or the results of a match in it. A call is identified by the address of its first argument, which is the start of the arguments the function is called with.
+func tailCallArguments(
+	body Value,
+	calls map[*Value]bool,
+) {
+	if body.Type != List || body.PreventEval {
+		return
+	}
+	list := body.Data.([]Value)
+	if len(list) < 2 {
+		return
+	}
+	if list[0].Type == Symbol {
+		switch list[0].Data.(string) {
+		case "if":
+			for _, branch := range list[2:] {
+				tailCallArguments(branch, calls)
+			}
+			return
+		case "match":
+			for _, clause := range list[2:] {
+				if clause.Type == List && len(clause.Data.([]Value)) == 2 {
+					tailCallArguments(clause.Data.([]Value)[1], calls)
+				}
+			}
+			return
+		}
+	}
+	calls[&list[1]] = true
+}
+
+// parseParameters parses the parameter list of a function or procedure. Each parameter is a symbol, optionally preceded by its type. For example `[int n]`. The list can end in `when` followed by a guard expression, which has to be truthy for the function to be called. For example `[int n when [int-greater n 0]]`.
+func parseParameters(
+	kind string,
+	parametersValue Value,
+) (
+	[]Parameter,
+	Value,
+	error,
+) {
+	if parametersValue.Type != List {
+		return nil, Value{}, errors.New(kind + " parameters must be a list")
+	}
+
+	parameterList := parametersValue.Data.([]Value)
+	var guard Value
+	if count := len(parameterList); count >= 2 && parameterList[count-2].Type == Symbol && parameterList[count-2].Data.(string) == "when" {
+		guard = parameterList[count-1]
+		parameterList = parameterList[:count-2]
+	} else if count > 0 && parameterList[count-1].Type == List {
+		// Without when, a list at the end is more likely a misplaced body than a guard.
+		return nil, Value{}, errors.New(kind + " guard must follow when")
+	}
+
+	var parameters []Parameter
+	for i := 0; i < len(parameterList); i++ {
+		if parameterList[i].Type != Symbol {
+			return nil, Value{}, errors.New(kind + " parameters must be symbols or types followed by symbols")
+		}
+		name := parameterList[i].Data.(string)
+		// A type name is only a type when a name follows it, otherwise it is the name of the parameter. For example `[list]` is a parameter called list.
+		parameterType, ok := parameterTypes[name]
+		if !ok || i+1 >= len(parameterList) || parameterList[i+1].Type != Symbol {
+			parameters = append(parameters, Parameter{
+				Name: name,
+			})
+			continue
+		}
+
+		i++
+		parameters = append(parameters, Parameter{
+			Name: parameterList[i].Data.(string),
+			Type: parameterType,
+		})
+	}
+	return parameters, guard, nil
+}
+
+// checkParameter returns an error if the value does not have the type of the parameter.
+func checkParameter(
+	parameter Parameter,
+	value Value,
+) error {
+	if parameter.Type == Unknown || parameter.Type == value.Type {
+		return nil
+	}
+	return errors.New("parameter '" + parameter.Name + "' expects " + typeToString(parameter.Type) + ", got " + typeToString(value.Type))
+}
+
+// logicalOperator creates and or or. The arguments are evaluated in order until one of them is truthy when stopAt is true, or falsy when it is false, which decides the result. Like if, only false and none are falsy.
+func logicalOperator(
+	name string,
+	stopAt bool,
+) Value {
+	return Value{
 		Type: Function,
 		Data: func(
 			args []Value,
-			_ *Environment,
+			env *Environment,
 		) (
 			Value,
 			error,
 		) {
-			if len(args) != 1 {
-				return Value{}, errors.New("Some requires exactly one argument")
+			// [and condition ...] or [or condition ...]
+			for _, arg := range args {
+				value, err := EvaluateUntilConcrete(arg, env)
+				if err != nil {
+					return Value{}, err
+				}
+				if isTruthy(value) == stopAt {
+					return Value{
+						Type: Bool,
+						Data: stopAt,
+					}, nil
+				}
 			}
 			return Value{
-				Type: Option,
-				Data: OptionValue{
-					Some:  true,
-					Value: args[0],
-				},
+				Type: Bool,
+				Data: !stopAt,
 			}, nil
 		},
-	})
-	env.Set("none", Value{
-		Type: Option,
-		Data: OptionValue{
-			Some: false,
-		},
-	})
+	}
+}
+
+// checkReturn checks the value returned by a function or procedure against its declared return type. If the value is not concrete yet the check is deferred until it is evaluated.
+func checkReturn(
+	value Value,
+	env *Environment,
+	check ReturnCheck,
+) (
+	Value,
+	error,
+) {
+	if check.Type == Unknown {
+		return value, nil
+	}
 
-	// Arithmetic operators.
-	env.Set("int-add", addInts)
-	env.Set("int-subtract", subtractInts)
+	if value.Type == Lazy {
+		thunk := value.Data.(*LazyData)
+		if thunk.Return.Type == Unknown && thunk.Transient && !thunk.Forced {
+			// The check is added to the body of the call itself, as nothing else refers to it.
+			thunk.Return = check
+			return value, nil
+		}
+		if thunk.Return == check {
+			// Recursive calls already perform the same check.
+			return value, nil
+		}
+		if value.Position == nil {
+			// A failed check is reported where the thunk was created.
+			value.Position = thunk.Expression.Position
+		}
+	}
+	if value.Type == Lazy || (value.Type == List && !value.PreventEval) {
+		return Value{
+			Type: Lazy,
+			Data: &LazyData{
+				Expression:  value,
+				Environment: env,
+				Return:      check,
+				Transient:   true,
+			},
+		}, nil
+	}
+
+	if value.Type != check.Type {
+		message := check.Definition + " must return " + typeToString(check.Type) + ", got " + typeToString(value.Type)
+		if check.Position != nil {
+			message += ", defined at " + check.Position.String()
+		}
+		return Value{}, errors.New(message)
+	}
+	return value, nil
+}
+
+// guardError is returned when the guard of a function or procedure does not pass, so an overload set can try the next candidate.
+type guardError struct {
+	Definition string
+}
+
+func (
+	e *guardError,
+) Error() string {
+	return "guard of " + e.Definition + " did not pass"
+}
+
+// checkGuard evaluates the guard of a function or procedure in the environment of its parameters.
+func checkGuard(
+	guard Value,
+	env *Environment,
+	definition string,
+) error {
+	if guard.Type == Unknown {
+		return nil
+	}
+	condition, err := EvaluateUntilConcrete(guard, env)
+	if err != nil {
+		return err
+	}
+	if !isTruthy(condition) {
+		return &guardError{
+			Definition: definition,
+		}
+	}
+	return nil
 }
@@ -2,36 +2,180 @@ package language
 
 import (
 	"errors"
+	"slices"
+	"strconv"
 )
 
-var addInts = Value{
-	Type: Function,
-	Data: func(
-		args []Value,
-		env *Environment,
-	) (
-		Value,
-		error,
-	) {
-		var sumInt int64 = 0
-		for _, arg := range args {
-			evaluatedArg, err := EvaluateUntilConcrete(arg, env)
+// number is the Go type of an int, float or fixed-point value.
+type number interface {
+	int64 | float64 | int32
+}
+
+// numberNames are the names of the number types in errors.
+var numberNames = map[ValueType]string{
+	Int:   "integers",
+	Float: "floats",
+	Fixed: "fixed-point numbers",
+}
+
+// evaluateNumbers evaluates the arguments of a builtin that only takes numbers of one type.
+func evaluateNumbers[T number](
+	name string,
+	numberType ValueType,
+	args []Value,
+	env *Environment,
+) (
+	[]T,
+	error,
+) {
+	numbers := make([]T, len(args))
+	for i, arg := range args {
+		evaluatedArg, err := EvaluateUntilConcrete(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		if evaluatedArg.Type != numberType {
+			return nil, errors.New("arguments to " + name + " must be " + numberNames[numberType])
+		}
+		numbers[i] = evaluatedArg.Data.(T)
+	}
+	return numbers, nil
+}
+
+// numberBuiltin creates a builtin of count numbers of one type, or of any number of them if count is -1.
+func numberBuiltin[T number](
+	name string,
+	numberType ValueType,
+	count int,
+	operation func(numbers []T) (Value, error),
+) Value {
+	return Value{
+		Type: Function,
+		Data: func(
+			args []Value,
+			env *Environment,
+		) (
+			Value,
+			error,
+		) {
+			if count == 1 && len(args) != 1 {
+				return Value{}, errors.New(name + " requires 1 argument")
+			}
+			if count > 1 && len(args) != count {
+				return Value{}, errors.New(name + " requires " + strconv.Itoa(count) + " arguments")
+			}
+			numbers, err := evaluateNumbers[T](name, numberType, args, env)
 			if err != nil {
 				return Value{}, err
 			}
-			if evaluatedArg.Type != Int {
-				return Value{}, errors.New("arguments to add must be integers")
-			}
-			sumInt += evaluatedArg.Data.(int64)
+			return operation(numbers)
+		},
+	}
+}
+
+// foldNumbers creates a builtin that combines any number of numbers with an operation, starting from the first. Without arguments it results in the identity of the operation.
+func foldNumbers[T number](
+	name string,
+	numberType ValueType,
+	identity T,
+	operation func(a T, b T) T,
+) Value {
+	return numberBuiltin(name, numberType, -1, func(numbers []T) (Value, error) {
+		result := identity
+		if len(numbers) > 0 {
+			result = numbers[0]
+			numbers = numbers[1:]
+		}
+		for _, number := range numbers {
+			result = operation(result, number)
+		}
+		return Value{
+			Type: numberType,
+			Data: result,
+		}, nil
+	})
+}
+
+// numberFunction creates a builtin of count numbers that results in a number of the same type.
+func numberFunction[T number](
+	name string,
+	numberType ValueType,
+	count int,
+	operation func(numbers []T) T,
+) Value {
+	return numberBuiltin(name, numberType, count, func(numbers []T) (Value, error) {
+		return Value{
+			Type: numberType,
+			Data: operation(numbers),
+		}, nil
+	})
+}
+
+// compareInts creates a builtin that compares two integers.
+func compareInts(
+	name string,
+	comparison func(a int64, b int64) bool,
+) Value {
+	return numberBuiltin(name, Int, 2, func(numbers []int64) (Value, error) {
+		return Value{
+			Type: Bool,
+			Data: comparison(numbers[0], numbers[1]),
+		}, nil
+	})
+}
+
+// shiftInts creates a builtin that shifts the bits of the first integer by the second. Shifting by 64 or more shifts every bit out, a negative amount is an error.
+func shiftInts(
+	name string,
+	shift func(n int64, amount uint64) int64,
+) Value {
+	return numberBuiltin(name, Int, 2, func(numbers []int64) (Value, error) {
+		if numbers[1] < 0 {
+			return Value{}, errors.New("amount to " + name + " must not be negative")
 		}
 		return Value{
 			Type: Int,
-			Data: sumInt,
+			Data: shift(numbers[0], uint64(numbers[1])),
 		}, nil
-	},
+	})
 }
 
-var subtractInts = Value{
+var addInts = foldNumbers("int-add", Int, 0, func(a int64, b int64) int64 {
+	return a + b
+})
+
+var subtractInts = foldNumbers("int-subtract", Int, 0, func(a int64, b int64) int64 {
+	return a - b
+})
+
+var multiplyInts = foldNumbers("int-multiply", Int, 1, func(a int64, b int64) int64 {
+	return a * b
+})
+
+// divideInts divides the first argument by the second, rounding towards zero. Dividing by zero results in an error value.
+var divideInts = numberBuiltin("int-divide", Int, 2, func(numbers []int64) (Value, error) {
+	if numbers[1] == 0 {
+		return errorValue("division by zero"), nil
+	}
+	return okValue(Value{
+		Type: Int,
+		Data: numbers[0] / numbers[1],
+	}), nil
+})
+
+// remainderInts is the remainder of dividing the first argument by the second, which has the sign of the first. Dividing by zero results in an error value.
+var remainderInts = numberBuiltin("int-remainder", Int, 2, func(numbers []int64) (Value, error) {
+	if numbers[1] == 0 {
+		return errorValue("division by zero"), nil
+	}
+	return okValue(Value{
+		Type: Int,
+		Data: numbers[0] % numbers[1],
+	}), nil
+})
+
+// parseInt parses a string as a base 10 integer. A string that is not an integer results in an error value.
+var parseInt = Value{
 	Type: Function,
 	Data: func(
 		args []Value,
@@ -40,25 +184,89 @@ var subtractInts = Value{
 		Value,
 		error,
 	) {
-		var resultInt int64 = 0
-		for i, arg := range args {
-			evaluatedArg, err := EvaluateUntilConcrete(arg, env)
-			if err != nil {
-				return Value{}, err
-			}
-			if evaluatedArg.Type != Int {
-				return Value{}, errors.New("arguments to subtract must be integers")
-			}
-			number := evaluatedArg.Data.(int64)
-			if i == 0 {
-				resultInt = number
-			} else {
-				resultInt -= number
-			}
+		if len(args) != 1 {
+			return Value{}, errors.New("int-parse requires 1 argument")
 		}
-		return Value{
+		evaluatedArg, err := EvaluateUntilConcrete(args[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		if evaluatedArg.Type != String {
+			return Value{}, errors.New("argument to int-parse must be a string")
+		}
+		intValue, err := strconv.ParseInt(evaluatedArg.Data.(string), 10, 64)
+		if err != nil {
+			return errorValue("'" + evaluatedArg.Data.(string) + "' is not an integer"), nil
+		}
+		return okValue(Value{
 			Type: Int,
-			Data: resultInt,
-		}, nil
+			Data: intValue,
+		}), nil
 	},
 }
+
+// negateInt wraps around for the smallest integer, which is its own negation.
+var negateInt = numberFunction("int-negate", Int, 1, func(numbers []int64) int64 {
+	return -numbers[0]
+})
+
+var absInt = numberFunction("int-abs", Int, 1, func(numbers []int64) int64 {
+	if numbers[0] < 0 {
+		return -numbers[0]
+	}
+	return numbers[0]
+})
+
+// minInts and maxInts take one or more integers.
+var minInts = numberBuiltin("int-min", Int, -1, func(numbers []int64) (Value, error) {
+	if len(numbers) == 0 {
+		return Value{}, errors.New("int-min requires at least 1 argument")
+	}
+	return Value{
+		Type: Int,
+		Data: slices.Min(numbers),
+	}, nil
+})
+
+var maxInts = numberBuiltin("int-max", Int, -1, func(numbers []int64) (Value, error) {
+	if len(numbers) == 0 {
+		return Value{}, errors.New("int-max requires at least 1 argument")
+	}
+	return Value{
+		Type: Int,
+		Data: slices.Max(numbers),
+	}, nil
+})
+
+var andInts = foldNumbers("int-and", Int, -1, func(a int64, b int64) int64 {
+	return a & b
+})
+
+var orInts = foldNumbers("int-or", Int, 0, func(a int64, b int64) int64 {
+	return a | b
+})
+
+var xorInts = foldNumbers("int-xor", Int, 0, func(a int64, b int64) int64 {
+	return a ^ b
+})
+
+var shiftLeftInt = shiftInts("int-shift-left", func(n int64, amount uint64) int64 {
+	return n << amount
+})
+
+// shiftRightInt shifts arithmetically, the sign bit is copied into the bits that are shifted in.
+var shiftRightInt = shiftInts("int-shift-right", func(n int64, amount uint64) int64 {
+	return n >> amount
+})
+
+var equalInts = compareInts("int-equal", func(a int64, b int64) bool {
+	return a == b
+})
+
+var lessInts = compareInts("int-less", func(a int64, b int64) bool {
+	return a < b
+})
+
+var greaterInts = compareInts("int-greater", func(a int64, b int64) bool {
+	return a > b
+})
@@ -0,0 +1,235 @@
+package language
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// fixedOne is 1 as a fixed-point number. Fixed-point numbers have 16 integer and 16 fractional bits and are stored as an int32, so 1.5x is 98304.
+const fixedOne = 1 << 16
+
+// The trigonometric functions use CORDIC with 30 fractional bits. cordicAngles are atan(2^-i) and cordicGain is the product of 1/sqrt(1+2^-2i), computed once and written out so no floating point is involved.
+var cordicAngles = [30]int64{
+	843314857, 497837829, 263043837, 133525159, 67021687, 33543516, 16775851, 8388437, 4194283, 2097149,
+	1048576, 524288, 262144, 131072, 65536, 32768, 16384, 8192, 4096, 2048,
+	1024, 512, 256, 128, 64, 32, 16, 8, 4, 2,
+}
+
+const (
+	cordicGain    = 652032874
+	cordicPi      = 3373259426
+	cordicHalfPi  = 1686629713
+	cordicTwoPi   = 6746518852
+	cordicShift   = 14
+	cordicRounder = 1 << (cordicShift - 1)
+)
+
+// parseFixed parses a fixed-point literal such as -1.25x, rounding the fraction to the nearest 1/65536.
+func parseFixed(
+	literal string,
+) (
+	int32,
+	error,
+) {
+	digits := strings.TrimSuffix(literal, "x")
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+	integerDigits, fractionDigits, _ := strings.Cut(digits, ".")
+
+	// The literal is scaled by 65536 exactly, then rounded half away from zero.
+	numerator, _ := new(big.Int).SetString(integerDigits+fractionDigits, 10)
+	denominator := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(len(fractionDigits))), nil)
+	numerator.Mul(numerator, big.NewInt(2*fixedOne))
+	numerator.Add(numerator, denominator)
+	numerator.Quo(numerator, denominator.Mul(denominator, big.NewInt(2)))
+	if negative {
+		numerator.Neg(numerator)
+	}
+	if !numerator.IsInt64() || numerator.Int64() < math.MinInt32 || numerator.Int64() > math.MaxInt32 {
+		return 0, errors.New("fixed-point literal " + literal + " is out of range")
+	}
+	return int32(numerator.Int64()), nil
+}
+
+// fixedToString returns the shortest decimal that parses back to the fixed-point number.
+func fixedToString(
+	fixed int32,
+) string {
+	magnitude := int64(fixed)
+	sign := ""
+	if magnitude < 0 {
+		magnitude = -magnitude
+		sign = "-"
+	}
+	integer := strconv.FormatInt(magnitude>>16, 10)
+	fraction := magnitude & (fixedOne - 1)
+	if fraction == 0 {
+		return sign + integer
+	}
+	scale := int64(1)
+	for places := 1; ; places++ {
+		scale *= 10
+		digits := (fraction*scale*2 + fixedOne) / (2 * fixedOne)
+		if digits < scale && (digits*2*fixedOne+scale)/(2*scale) == fraction {
+			text := strconv.FormatInt(digits, 10)
+			return sign + integer + "." + strings.Repeat("0", places-len(text)) + text
+		}
+	}
+}
+
+// fromCordic rounds a number with 30 fractional bits to a fixed-point number.
+func fromCordic(
+	n int64,
+) int32 {
+	return int32((n + cordicRounder) >> cordicShift)
+}
+
+// cordicRotate returns the cosine and sine of an angle in radians with 30 fractional bits.
+func cordicRotate(
+	angle int64,
+) (
+	int64,
+	int64,
+) {
+	angle %= cordicTwoPi
+	if angle > cordicPi {
+		angle -= cordicTwoPi
+	} else if angle < -cordicPi {
+		angle += cordicTwoPi
+	}
+	// CORDIC converges for angles within a quarter turn, the others are turned by half a turn which negates both results.
+	sign := int64(1)
+	if angle > cordicHalfPi {
+		angle -= cordicPi
+		sign = -1
+	} else if angle < -cordicHalfPi {
+		angle += cordicPi
+		sign = -1
+	}
+	x, y := int64(cordicGain), int64(0)
+	for i, step := range cordicAngles {
+		if angle >= 0 {
+			x, y, angle = x-y>>i, y+x>>i, angle-step
+		} else {
+			x, y, angle = x+y>>i, y-x>>i, angle+step
+		}
+	}
+	return sign * x, sign * y
+}
+
+// cordicAngle returns the angle in radians of the point [x y] with 30 fractional bits.
+func cordicAngle(
+	x int64,
+	y int64,
+) int64 {
+	if x == 0 && y == 0 {
+		return 0
+	}
+	// CORDIC converges for points to the right of the origin, the others are turned by half a turn first.
+	var angle int64
+	if x < 0 {
+		x, y = -x, -y
+		if y > 0 {
+			angle = -cordicPi
+		} else {
+			angle = cordicPi
+		}
+	}
+	for i, step := range cordicAngles {
+		if y > 0 {
+			x, y, angle = x+y>>i, y-x>>i, angle+step
+		} else {
+			x, y, angle = x-y>>i, y+x>>i, angle-step
+		}
+	}
+	return angle
+}
+
+var addFixeds = foldNumbers("fixed-add", Fixed, 0, func(a int32, b int32) int32 {
+	return a + b
+})
+
+var subtractFixeds = foldNumbers("fixed-subtract", Fixed, 0, func(a int32, b int32) int32 {
+	return a - b
+})
+
+// multiplyFixeds rounds the product down to the nearest 1/65536.
+var multiplyFixeds = foldNumbers("fixed-multiply", Fixed, fixedOne, func(a int32, b int32) int32 {
+	return int32(int64(a) * int64(b) >> 16)
+})
+
+// divideFixeds rounds towards zero and results in an error value for a zero divisor, like divideInts.
+var divideFixeds = numberBuiltin("fixed-divide", Fixed, 2, func(numbers []int32) (Value, error) {
+	if numbers[1] == 0 {
+		return errorValue("division by zero"), nil
+	}
+	return okValue(Value{
+		Type: Fixed,
+		Data: int32(int64(numbers[0]) << 16 / int64(numbers[1])),
+	}), nil
+})
+
+// sinFixed, cosFixed and atan2Fixed work like their float counterparts, with CORDIC instead of floating point.
+var sinFixed = numberFunction("fixed-sin", Fixed, 1, func(numbers []int32) int32 {
+	_, sin := cordicRotate(int64(numbers[0]) << cordicShift)
+	return fromCordic(sin)
+})
+
+var cosFixed = numberFunction("fixed-cos", Fixed, 1, func(numbers []int32) int32 {
+	cos, _ := cordicRotate(int64(numbers[0]) << cordicShift)
+	return fromCordic(cos)
+})
+
+var atan2Fixed = numberFunction("fixed-atan2", Fixed, 2, func(numbers []int32) int32 {
+	return fromCordic(cordicAngle(int64(numbers[1])<<cordicShift, int64(numbers[0])<<cordicShift))
+})
+
+// intToFixed only converts integers from -32768 to 32767, like a literal the others are out of range.
+var intToFixed = numberBuiltin("int-to-fixed", Int, 1, func(numbers []int64) (Value, error) {
+	if numbers[0] < math.MinInt16 || numbers[0] > math.MaxInt16 {
+		return Value{}, errors.New("fixed-point number " + strconv.FormatInt(numbers[0], 10) + " is out of range")
+	}
+	return Value{
+		Type: Fixed,
+		Data: int32(numbers[0] << 16),
+	}, nil
+})
+
+// fixedToInt rounds towards zero.
+var fixedToInt = numberBuiltin("fixed-to-int", Fixed, 1, func(numbers []int32) (Value, error) {
+	return Value{
+		Type: Int,
+		Data: int64(numbers[0]) / fixedOne,
+	}, nil
+})
+
+// floatToFixed rounds to the nearest 1/65536. Floats outside the range of a fixed-point number saturate at the smallest or largest one, and not a number becomes 0.
+var floatToFixed = numberBuiltin("float-to-fixed", Float, 1, func(numbers []float64) (Value, error) {
+	scaled := math.Round(numbers[0] * fixedOne)
+	var result int32
+	switch {
+	case math.IsNaN(scaled):
+		result = 0
+	case scaled >= math.MaxInt32:
+		result = math.MaxInt32
+	case scaled <= math.MinInt32:
+		result = math.MinInt32
+	default:
+		result = int32(scaled)
+	}
+	return Value{
+		Type: Fixed,
+		Data: result,
+	}, nil
+})
+
+// fixedToFloat is exact, every fixed-point number is a float.
+var fixedToFloat = numberBuiltin("fixed-to-float", Fixed, 1, func(numbers []int32) (Value, error) {
+	return Value{
+		Type: Float,
+		Data: float64(numbers[0]) / fixedOne,
+	}, nil
+})
@@ -0,0 +1,79 @@
+package language
+
+import (
+	"math"
+)
+
+var addFloats = foldNumbers("float-add", Float, 0, func(a float64, b float64) float64 {
+	return a + b
+})
+
+var subtractFloats = foldNumbers("float-subtract", Float, 0, func(a float64, b float64) float64 {
+	return a - b
+})
+
+var multiplyFloats = foldNumbers("float-multiply", Float, 1, func(a float64, b float64) float64 {
+	return a * b
+})
+
+var divideFloats = numberFunction("float-divide", Float, 2, func(numbers []float64) float64 {
+	return numbers[0] / numbers[1]
+})
+
+var floorFloat = numberFunction("float-floor", Float, 1, func(numbers []float64) float64 {
+	return math.Floor(numbers[0])
+})
+
+var ceilFloat = numberFunction("float-ceil", Float, 1, func(numbers []float64) float64 {
+	return math.Ceil(numbers[0])
+})
+
+// roundFloat rounds half away from zero.
+var roundFloat = numberFunction("float-round", Float, 1, func(numbers []float64) float64 {
+	return math.Round(numbers[0])
+})
+
+var sqrtFloat = numberFunction("float-sqrt", Float, 1, func(numbers []float64) float64 {
+	return math.Sqrt(numbers[0])
+})
+
+// sinFloat and cosFloat take an angle in radians.
+var sinFloat = numberFunction("float-sin", Float, 1, func(numbers []float64) float64 {
+	return math.Sin(numbers[0])
+})
+
+var cosFloat = numberFunction("float-cos", Float, 1, func(numbers []float64) float64 {
+	return math.Cos(numbers[0])
+})
+
+// atan2Float is the angle in radians of the point [x y], given as y and x like the C function.
+var atan2Float = numberFunction("float-atan2", Float, 2, func(numbers []float64) float64 {
+	return math.Atan2(numbers[0], numbers[1])
+})
+
+var intToFloat = numberBuiltin("int-to-float", Int, 1, func(numbers []int64) (Value, error) {
+	return Value{
+		Type: Float,
+		Data: float64(numbers[0]),
+	}, nil
+})
+
+// floatToInt rounds towards zero. Floats outside the range of an integer saturate at the smallest or largest integer, and not a number becomes 0.
+var floatToInt = numberBuiltin("float-to-int", Float, 1, func(numbers []float64) (Value, error) {
+	number := numbers[0]
+	var result int64
+	switch {
+	case math.IsNaN(number):
+		result = 0
+	case number >= math.MaxInt64:
+		result = math.MaxInt64
+	case number <= math.MinInt64:
+		result = math.MinInt64
+	default:
+		result = int64(number)
+	}
+	return Value{
+		Type: Int,
+		Data: result,
+	}, nil
+})
@@ -0,0 +1,250 @@
+package language
+
+import (
+	"errors"
+	"strconv"
+)
+
+// listValue creates a list that is data rather than a call, so it is never evaluated again. The builtins never change a list, they return a new one.
+func listValue(
+	values []Value,
+) Value {
+	return Value{
+		Type:        List,
+		Data:        values,
+		PreventEval: true,
+	}
+}
+
+// evaluateList evaluates an expression that should result in a list.
+func evaluateList(
+	expression Value,
+	env *Environment,
+) (
+	[]Value,
+	error,
+) {
+	value, err := EvaluateUntilConcrete(expression, env)
+	if err != nil {
+		return nil, err
+	}
+	if value.Type != List {
+		return nil, errors.New("expected a list, got " + typeToString(value.Type))
+	}
+	return value.Data.([]Value), nil
+}
+
+// evaluateIndex evaluates an expression that should result in an integer used as an index.
+func evaluateIndex(
+	expression Value,
+	env *Environment,
+) (
+	int64,
+	error,
+) {
+	value, err := EvaluateUntilConcrete(expression, env)
+	if err != nil {
+		return 0, err
+	}
+	if value.Type != Int {
+		return 0, errors.New("expected an integer index, got " + typeToString(value.Type))
+	}
+	return value.Data.(int64), nil
+}
+
+// constructList evaluates its arguments and creates a list of them.
+var constructList = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [list value ...]
+		if err := env.interpreter.allocate(len(args)); err != nil {
+			return Value{}, err
+		}
+		values := make([]Value, len(args))
+		for index, arg := range args {
+			value, err := EvaluateUntilConcrete(arg, env)
+			if err != nil {
+				return Value{}, err
+			}
+			values[index] = value
+		}
+		return listValue(values), nil
+	},
+}
+
+var listLength = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		if len(args) != 1 {
+			return Value{}, errors.New("list-length requires 1 argument")
+		}
+		list, err := evaluateList(args[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{
+			Type: Int,
+			Data: int64(len(list)),
+		}, nil
+	},
+}
+
+// listGet returns the element at an index, counting from 0, as an option that is none when the index is out of range.
+var listGet = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [list-get list index]
+		if len(args) != 2 {
+			return Value{}, errors.New("list-get requires 2 arguments")
+		}
+		list, err := evaluateList(args[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		index, err := evaluateIndex(args[1], env)
+		if err != nil {
+			return Value{}, err
+		}
+		if index < 0 || index >= int64(len(list)) {
+			return Value{
+				Type: Option,
+				Data: OptionValue{
+					Some: false,
+				},
+			}, nil
+		}
+		return Value{
+			Type: Option,
+			Data: OptionValue{
+				Some:  true,
+				Value: list[index],
+			},
+		}, nil
+	},
+}
+
+// addToList creates list-prepend or list-append, which return a copy of a list with a value added at the start or the end.
+func addToList(
+	name string,
+	atStart bool,
+) Value {
+	return Value{
+		Type: Function,
+		Data: func(
+			args []Value,
+			env *Environment,
+		) (
+			Value,
+			error,
+		) {
+			// [list-prepend list value] or [list-append list value]
+			if len(args) != 2 {
+				return Value{}, errors.New(name + " requires 2 arguments")
+			}
+			list, err := evaluateList(args[0], env)
+			if err != nil {
+				return Value{}, err
+			}
+			value, err := EvaluateUntilConcrete(args[1], env)
+			if err != nil {
+				return Value{}, err
+			}
+			if err := env.interpreter.allocate(len(list) + 1); err != nil {
+				return Value{}, err
+			}
+			values := make([]Value, 0, len(list)+1)
+			if atStart {
+				values = append(values, value)
+			}
+			values = append(values, list...)
+			if !atStart {
+				values = append(values, value)
+			}
+			return listValue(values), nil
+		},
+	}
+}
+
+// listSlice returns the elements from the start index up to but not including the end index. Indices out of range result in an error value.
+var listSlice = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [list-slice list start end]
+		if len(args) != 3 {
+			return Value{}, errors.New("list-slice requires 3 arguments")
+		}
+		list, err := evaluateList(args[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		start, err := evaluateIndex(args[1], env)
+		if err != nil {
+			return Value{}, err
+		}
+		end, err := evaluateIndex(args[2], env)
+		if err != nil {
+			return Value{}, err
+		}
+		if start < 0 || end < start || end > int64(len(list)) {
+			return errorValue("slice from " + strconv.FormatInt(start, 10) + " to " + strconv.FormatInt(end, 10) + " is out of range for a list of length " + strconv.Itoa(len(list))), nil
+		}
+		// The capacity is limited so the slice shares the elements without ever being appended to in place.
+		return okValue(listValue(list[start:end:end])), nil
+	},
+}
+
+// concatenateLists returns a list of the elements of all the lists in order.
+var concatenateLists = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [list-concat list ...]
+		lists := make([][]Value, len(args))
+		length := 0
+		for index, arg := range args {
+			list, err := evaluateList(arg, env)
+			if err != nil {
+				return Value{}, err
+			}
+			lists[index] = list
+			length += len(list)
+		}
+		if err := env.interpreter.allocate(length); err != nil {
+			return Value{}, err
+		}
+		values := make([]Value, 0, length)
+		for _, list := range lists {
+			values = append(values, list...)
+		}
+		return listValue(values), nil
+	},
+}
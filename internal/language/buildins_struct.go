@@ -0,0 +1,219 @@
+package language
+
+import (
+	"errors"
+)
+
+var defineStruct = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		_ *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [struct [type field] [type field] ...]
+		if len(args) == 0 {
+			return Value{}, errors.New("struct requires at least one field")
+		}
+		definition := &StructDefinitionData{}
+		for _, arg := range args {
+			if arg.Type != List {
+				return Value{}, errors.New("struct fields must be lists of a type and a name")
+			}
+			fieldList := arg.Data.([]Value)
+			if len(fieldList) != 2 || fieldList[0].Type != Symbol || fieldList[1].Type != Symbol {
+				return Value{}, errors.New("struct fields must be lists of a type and a name")
+			}
+			fieldType, ok := parameterTypes[fieldList[0].Data.(string)]
+			if !ok {
+				return Value{}, errors.New("struct field type must be a type, got " + fieldList[0].Data.(string))
+			}
+			name := fieldList[1].Data.(string)
+			if definition.fieldIndex(name) >= 0 {
+				return Value{}, errors.New("struct field '" + name + "' is defined more than once")
+			}
+			definition.Fields = append(definition.Fields, Field{
+				Name: name,
+				Type: fieldType,
+			})
+		}
+		return Value{
+			Type: StructDefinition,
+			Data: definition,
+		}, nil
+	},
+}
+
+var getStructField = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [struct-get instance field]
+		if len(args) != 2 {
+			return Value{}, errors.New("struct-get requires 2 arguments")
+		}
+		instance, err := evaluateStruct(args[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		index, err := instance.field(args[1])
+		if err != nil {
+			return Value{}, err
+		}
+		return instance.Values[index], nil
+	},
+}
+
+var setStructFields = Value{
+	Type: Function,
+	Data: func(
+		args []Value,
+		env *Environment,
+	) (
+		Value,
+		error,
+	) {
+		// [struct-set instance field value field value ...]
+		if len(args) < 3 || len(args)%2 != 1 {
+			return Value{}, errors.New("struct-set requires an instance followed by pairs of fields and values")
+		}
+		instance, err := evaluateStruct(args[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+
+		// The instance is copied so that the original remains unchanged.
+		if err := env.interpreter.allocate(len(instance.Values)); err != nil {
+			return Value{}, err
+		}
+		values := append([]Value{}, instance.Values...)
+		for i := 1; i < len(args); i += 2 {
+			index, err := instance.field(args[i])
+			if err != nil {
+				return Value{}, err
+			}
+			value, err := EvaluateUntilConcrete(args[i+1], env)
+			if err != nil {
+				return Value{}, err
+			}
+			if err := instance.Definition.checkField(index, value); err != nil {
+				return Value{}, err
+			}
+			values[index] = value
+		}
+		return Value{
+			Type: Struct,
+			Data: StructData{
+				Definition: instance.Definition,
+				Values:     values,
+			},
+		}, nil
+	},
+}
+
+// constructStruct creates an instance of a struct, the arguments are the values of the fields in the order they are defined.
+func constructStruct(
+	definition *StructDefinitionData,
+	args []Value,
+	env *Environment,
+) (
+	Value,
+	error,
+) {
+	if len(args) != len(definition.Fields) {
+		return Value{}, errors.New("incorrect number of fields for struct")
+	}
+	if err := env.interpreter.allocate(len(args)); err != nil {
+		return Value{}, err
+	}
+	values := make([]Value, len(args))
+	for index, arg := range args {
+		value, err := EvaluateUntilConcrete(arg, env)
+		if err != nil {
+			return Value{}, err
+		}
+		if err := definition.checkField(index, value); err != nil {
+			return Value{}, err
+		}
+		values[index] = value
+	}
+	return Value{
+		Type: Struct,
+		Data: StructData{
+			Definition: definition,
+			Values:     values,
+		},
+	}, nil
+}
+
+// evaluateStruct evaluates an expression that should result in a struct instance.
+func evaluateStruct(
+	expression Value,
+	env *Environment,
+) (
+	StructData,
+	error,
+) {
+	value, err := EvaluateUntilConcrete(expression, env)
+	if err != nil {
+		return StructData{}, err
+	}
+	if value.Type != Struct {
+		return StructData{}, errors.New("expected a struct, got " + typeToString(value.Type))
+	}
+	return value.Data.(StructData), nil
+}
+
+// fieldIndex returns the index of the field with the given name, or -1 if there is no such field.
+func (
+	d *StructDefinitionData,
+) fieldIndex(
+	name string,
+) int {
+	for index, field := range d.Fields {
+		if field.Name == name {
+			return index
+		}
+	}
+	return -1
+}
+
+// checkField returns an error if the value does not have the type of the field at the index.
+func (
+	d *StructDefinitionData,
+) checkField(
+	index int,
+	value Value,
+) error {
+	field := d.Fields[index]
+	if field.Type != value.Type {
+		return errors.New("struct field '" + field.Name + "' expects " + typeToString(field.Type) + ", got " + typeToString(value.Type))
+	}
+	return nil
+}
+
+// field returns the index of the field named by the symbol.
+func (
+	s StructData,
+) field(
+	symbol Value,
+) (
+	int,
+	error,
+) {
+	if symbol.Type != Symbol {
+		return -1, errors.New("struct field must be a symbol")
+	}
+	index := s.Definition.fieldIndex(symbol.Data.(string))
+	if index < 0 {
+		return -1, errors.New("struct has no field '" + symbol.Data.(string) + "'")
+	}
+	return index, nil
+}
@@ -0,0 +1,28 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestBuiltinSignatures(
+	t *testing.T,
+) {
+	fresh := func() *Type {
+		return &Type{}
+	}
+	for name, builtin := range builtins {
+		if builtin.Type == nil {
+			continue
+		}
+		signature := builtin.Type(fresh)
+		if signature.Variadic != nil {
+			if builtin.Arity[1] != -1 {
+				t.Errorf("%s takes any number of arguments for the inference, but at most %d for the checker", name, builtin.Arity[1])
+			}
+			continue
+		}
+		if builtin.Arity != [2]int{len(signature.Parameters), len(signature.Parameters)} {
+			t.Errorf("%s takes %d arguments for the inference, but %v for the checker", name, len(signature.Parameters), builtin.Arity)
+		}
+	}
+}
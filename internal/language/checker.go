@@ -0,0 +1,388 @@
+package language
+
+import (
+	"fmt"
+)
+
+// Diagnostic is a problem in a program that is found without evaluating it.
+type Diagnostic struct {
+	File    string
+	Row     int
+	Column  int
+	Message string
+}
+
+func (
+	d Diagnostic,
+) String() string {
+	return fmt.Sprintf("%s:%d:%d %s", d.File, d.Row, d.Column, d.Message)
+}
+
+// Check walks the expression returned by Parse and reports the problems it finds without evaluating it. It reports undefined symbols, builtins called with the wrong number of arguments, malformed function and procedure definitions and malformed match clauses. The names defined in the environment, such as the builtins, are taken to exist. Imported modules are checked as well.
+func Check(
+	expression Value,
+	env *Environment,
+) []Diagnostic {
+	c := &checker{
+		modules: make(map[*ModuleData]bool),
+	}
+	scope := newCheckScope(nil, env)
+	scope.hoist(expression)
+	c.check(expression, scope)
+	return c.diagnostics
+}
+
+// checker collects the diagnostics while walking the expressions.
+type checker struct {
+	diagnostics []Diagnostic
+	modules     map[*ModuleData]bool
+}
+
+// symbolKind is what a name in a check scope refers to.
+type symbolKind int
+
+const (
+	symbolValue symbolKind = iota
+	symbolStruct
+	symbolBuiltin
+)
+
+// checkScope mirrors an Environment during checking, it only knows the names that are defined and not their values.
+type checkScope struct {
+	names map[string]symbolKind
+	outer *checkScope
+	env   *Environment
+}
+
+func newCheckScope(
+	outer *checkScope,
+	env *Environment,
+) *checkScope {
+	return &checkScope{
+		names: make(map[string]symbolKind),
+		outer: outer,
+		env:   env,
+	}
+}
+
+// lookup returns what a name refers to and whether it is defined.
+func (
+	s *checkScope,
+) lookup(
+	name string,
+) (
+	symbolKind,
+	bool,
+) {
+	for scope := s; scope != nil; scope = scope.outer {
+		if kind, ok := scope.names[name]; ok {
+			return kind, true
+		}
+		if scope.outer == nil && scope.env != nil {
+			value, err := scope.env.Get(name)
+			if err != nil {
+				return symbolValue, false
+			}
+			if value.Type == StructDefinition {
+				return symbolStruct, true
+			}
+			if _, ok := value.Data.(func([]Value, *Environment) (Value, error)); ok {
+				return symbolBuiltin, true
+			}
+			return symbolValue, true
+		}
+	}
+	return symbolValue, false
+}
+
+// hoist adds the names defined in the expression to the scope, so definitions can refer to each other regardless of their order. Functions and procedures have a scope of their own and are skipped.
+func (
+	s *checkScope,
+) hoist(
+	expression Value,
+) {
+	if expression.Type != List {
+		return
+	}
+	list := expression.Data.([]Value)
+	if len(list) == 0 {
+		return
+	}
+	if list[0].Type == Symbol {
+		switch list[0].Data.(string) {
+		case "function", "procedure":
+			return
+		case "define":
+			if len(list) == 3 && list[1].Type == Symbol {
+				kind := symbolValue
+				if isForm(list[2], "struct") {
+					kind = symbolStruct
+				}
+				s.names[list[1].Data.(string)] = kind
+			}
+		}
+	}
+	for _, elem := range list {
+		s.hoist(elem)
+	}
+}
+
+// isForm reports whether the expression is a list starting with the given symbol.
+func isForm(
+	expression Value,
+	name string,
+) bool {
+	if expression.Type != List {
+		return false
+	}
+	list := expression.Data.([]Value)
+	return len(list) > 0 && list[0].Type == Symbol && list[0].Data.(string) == name
+}
+
+// report adds a diagnostic at the position of the expression.
+func (
+	c *checker,
+) report(
+	expression Value,
+	message string,
+) {
+	diagnostic := Diagnostic{
+		Message: message,
+	}
+	if expression.Position != nil {
+		diagnostic.File = expression.Position.File
+		diagnostic.Row = expression.Position.Row
+		diagnostic.Column = expression.Position.Column
+	}
+	c.diagnostics = append(c.diagnostics, diagnostic)
+}
+
+// check checks an expression that will be evaluated in the scope.
+func (
+	c *checker,
+) check(
+	expression Value,
+	scope *checkScope,
+) {
+	switch expression.Type {
+	case Symbol:
+		if _, ok := scope.lookup(expression.Data.(string)); !ok {
+			c.report(expression, "undefined symbol '"+expression.Data.(string)+"'")
+		}
+
+	case Import:
+		c.checkImport(expression.Data.(ImportData), scope)
+
+	case List:
+		if expression.PreventEval {
+			return
+		}
+		list := expression.Data.([]Value)
+		if len(list) == 0 {
+			return
+		}
+		if list[0].Type == Symbol {
+			name := list[0].Data.(string)
+			if kind, ok := scope.lookup(name); ok && kind == symbolBuiltin {
+				if c.checkBuiltin(expression, name, list[1:], scope) {
+					return
+				}
+			}
+		}
+		for _, elem := range list {
+			c.check(elem, scope)
+		}
+	}
+}
+
+// checkImport adds the imported names to the scope and checks the imported module the first time it is seen.
+func (
+	c *checker,
+) checkImport(
+	data ImportData,
+	scope *checkScope,
+) {
+	for _, name := range data.Names {
+		if data.Prefix != "" {
+			name = data.Prefix + "-" + name
+		}
+		scope.names[name] = symbolValue
+	}
+
+	if c.modules[data.Module] {
+		return
+	}
+	c.modules[data.Module] = true
+	moduleScope := newCheckScope(nil, data.Module.Environment)
+	for _, expression := range data.Module.Expressions {
+		moduleScope.hoist(expression)
+	}
+	for _, expression := range data.Module.Expressions {
+		c.check(expression, moduleScope)
+	}
+}
+
+// checkBuiltin checks a call to a builtin. It reports whether the arguments have been checked, builtins without special forms leave this to the caller.
+func (
+	c *checker,
+) checkBuiltin(
+	expression Value,
+	name string,
+	args []Value,
+	scope *checkScope,
+) bool {
+	if builtin, ok := builtins[name]; ok && builtin.Value.Type == Function {
+		arity := builtin.Arity
+		if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+			c.report(expression, name+" "+arityToString(arity)+", got "+fmt.Sprint(len(args)))
+			return true
+		}
+	}
+
+	switch name {
+	case "define":
+		if args[0].Type != Symbol {
+			c.report(args[0], "first argument to define must be a symbol")
+		}
+		c.check(args[1], scope)
+		return true
+
+	case "function", "procedure":
+		c.checkFunction(name, args, scope)
+		return true
+
+	case "match":
+		c.check(args[0], scope)
+		for _, clause := range args[1:] {
+			if clause.Type != List || len(clause.Data.([]Value)) != 2 {
+				c.report(clause, "each clause in match must be a list of a pattern and a result")
+				continue
+			}
+			clauseList := clause.Data.([]Value)
+			clauseScope := newCheckScope(scope, nil)
+			c.checkPattern(clauseList[0], scope, clauseScope, false)
+			clauseScope.hoist(clauseList[1])
+			c.check(clauseList[1], clauseScope)
+		}
+		return true
+
+	case "struct":
+		for _, field := range args {
+			fieldList, _ := field.Data.([]Value)
+			if field.Type != List || len(fieldList) != 2 || fieldList[0].Type != Symbol || fieldList[1].Type != Symbol {
+				c.report(field, "struct fields must be lists of a type and a name")
+				continue
+			}
+			if _, ok := parameterTypes[fieldList[0].Data.(string)]; !ok {
+				c.report(fieldList[0], "struct field type must be a type, got "+fieldList[0].Data.(string))
+			}
+		}
+		return true
+
+	case "struct-get", "struct-set":
+		c.check(args[0], scope)
+		for i := 1; i < len(args); i++ {
+			if i%2 == 1 {
+				if args[i].Type != Symbol {
+					c.report(args[i], "struct field must be a symbol")
+				}
+				continue
+			}
+			c.check(args[i], scope)
+		}
+		return true
+	}
+	return false
+}
+
+// checkFunction checks the signature and body of a function or procedure.
+func (
+	c *checker,
+) checkFunction(
+	kind string,
+	args []Value,
+	scope *checkScope,
+) {
+	_, rest, err := parseReturnType(kind, args)
+	if err != nil {
+		c.report(args[0], err.Error())
+		return
+	}
+	parameters, guard, err := parseParameters(kind, rest[0])
+	if err != nil {
+		c.report(rest[0], err.Error())
+		return
+	}
+
+	innerScope := newCheckScope(scope, nil)
+	for _, parameter := range parameters {
+		innerScope.names[parameter.Name] = symbolValue
+	}
+	if guard.Type != Unknown {
+		c.check(guard, innerScope)
+	}
+	innerScope.hoist(rest[1])
+	c.check(rest[1], innerScope)
+}
+
+// checkPattern checks a match pattern. Symbols inside destructuring patterns are bound in the bindings scope, other expressions are checked in the scope of the match.
+func (
+	c *checker,
+) checkPattern(
+	pattern Value,
+	scope *checkScope,
+	bindings *checkScope,
+	nested bool,
+) {
+	if pattern.Type == Symbol {
+		name := pattern.Data.(string)
+		if name == "_" || name == "none" {
+			return
+		}
+		if nested {
+			bindings.names[name] = symbolValue
+			return
+		}
+	}
+
+	if pattern.Type == List {
+		patternList := pattern.Data.([]Value)
+		if len(patternList) > 0 && patternList[0].Type == Symbol {
+			destructuring := false
+			switch head := patternList[0].Data.(string); head {
+			case "some", "ok", "error":
+				destructuring = len(patternList) == 2
+			case "cons":
+				destructuring = len(patternList) == 3
+			case "list":
+				destructuring = true
+			default:
+				kind, ok := scope.lookup(head)
+				destructuring = ok && kind == symbolStruct
+			}
+			if destructuring {
+				for _, subpattern := range patternList[1:] {
+					c.checkPattern(subpattern, scope, bindings, true)
+				}
+				return
+			}
+		}
+	}
+	c.check(pattern, scope)
+}
+
+// arityToString describes the number of arguments a builtin accepts.
+func arityToString(
+	arity [2]int,
+) string {
+	if arity[1] < 0 {
+		return fmt.Sprintf("requires at least %d arguments", arity[0])
+	}
+	if arity[0] == arity[1] {
+		if arity[0] == 1 {
+			return "requires 1 argument"
+		}
+		return fmt.Sprintf("requires %d arguments", arity[0])
+	}
+	return fmt.Sprintf("requires %d to %d arguments", arity[0], arity[1])
+}
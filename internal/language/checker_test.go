@@ -0,0 +1,102 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestCheck(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`
+			[define calc-fib
+				[function [n]
+					[match n
+						[0 0]
+						[1 1]
+						[_ [int-add [calc-fib [int-subtract n 1]] [calc-fib [int-subtract n 2]]]]
+					]
+				]
+			]
+		`, nil},
+		{"[match [some 1] [[some [pair x]] x] [none 0]]", []string{
+			"<test>:1:25 undefined symbol 'pair'",
+			"<test>:1:30 undefined symbol 'x'",
+			"<test>:1:34 undefined symbol 'x'",
+		}},
+		{"[define pair [struct [int x] [int y]]]", nil},
+		{"[define swap [function [p] [match p [[list a b] [struct-get b x]] [[cons head tail] head]]]]", nil},
+		{"[int-add count 1]", []string{"<test>:1:10 undefined symbol 'count'"}},
+		{"[if true]", []string{"<test>:1:1 if requires 2 to 3 arguments, got 1"}},
+		{"[define x]", []string{"<test>:1:1 define requires 2 arguments, got 1"}},
+		{"[define [x] 1]", []string{"<test>:1:9 first argument to define must be a symbol"}},
+		{"[function [int] int]", nil},
+		{"[function [string result] [int-add result option]]", []string{"<test>:1:43 undefined symbol 'option'"}},
+		{"[procedure number [] 1]", []string{"<test>:1:12 procedure return type must be a type, got number"}},
+		{"[function [[a] b] a]", []string{"<test>:1:11 function parameters must be symbols or types followed by symbols"}},
+		{"[function [int n when [int-add n m]] n]", []string{"<test>:1:34 undefined symbol 'm'"}},
+		{"[procedure [n [print n]] n]", []string{"<test>:1:12 procedure guard must follow when"}},
+		{"[match 1 [1 2 3] [_]]", []string{
+			"<test>:1:10 each clause in match must be a list of a pattern and a result",
+			"<test>:1:18 each clause in match must be a list of a pattern and a result",
+		}},
+		{"[match 1 [[some x] y]]", []string{"<test>:1:20 undefined symbol 'y'"}},
+		{"[struct [int x] [number y] z]", []string{
+			"<test>:1:18 struct field type must be a type, got number",
+			"<test>:1:28 struct fields must be lists of a type and a name",
+		}},
+	}
+	for _, test := range tests {
+		expression, err := Parse(test.input, "<test>", nil)
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", test.input, err)
+		}
+		diagnostics := Check(expression, env)
+		if len(diagnostics) != len(test.expected) {
+			t.Errorf("For %s: expected %d diagnostics, got %v", test.input, len(test.expected), diagnostics)
+			continue
+		}
+		for i, diagnostic := range diagnostics {
+			if diagnostic.String() != test.expected[i] {
+				t.Errorf("For %s: expected %q, got %q", test.input, test.expected[i], diagnostic.String())
+			}
+		}
+		if len(diagnostics) == 0 {
+			// Definitions are made so that later inputs can refer to them.
+			_ = evaluateOrFail(test.input, env, t)
+		}
+	}
+}
+
+func TestCheckImports(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	files := map[string]string{
+		"lib": "[define shift [function [n] [int-add n offset]]]",
+	}
+
+	expression, err := Parse("[define use [function [] [lib-shift 1]]]", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if diagnostics := Check(expression, env); len(diagnostics) != 1 {
+		t.Errorf("expected an undefined symbol, got %v", diagnostics)
+	}
+
+	expression, err = Parse("[import 'lib' as lib]", "<test>", mapResolver(files))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	diagnostics := Check(expression, env)
+	if len(diagnostics) != 1 || diagnostics[0].String() != "lib:1:40 undefined symbol 'offset'" {
+		t.Errorf("expected the imported module to be checked, got %v", diagnostics)
+	}
+}
@@ -0,0 +1,859 @@
+package language
+
+import (
+	"errors"
+)
+
+// Opcode is an instruction of the virtual machine.
+type Opcode byte
+
+const (
+	// OpConstant pushes constant A.
+	OpConstant Opcode = iota
+	// OpLoadLocal pushes slot B of the frame A levels up, evaluating it if it is an argument that has not been evaluated yet. C is the name of the slot.
+	OpLoadLocal
+	// OpStoreLocal stores the value on top of the stack in slot A, and leaves it on the stack.
+	OpStoreLocal
+	// OpLoadGlobal pushes the value of name A in the environment.
+	OpLoadGlobal
+	// OpDefineGlobal binds name A in the environment to the value on top of the stack, and leaves it on the stack.
+	OpDefineGlobal
+	// OpPop removes the value on top of the stack.
+	OpPop
+	// OpJump continues at instruction A.
+	OpJump
+	// OpJumpIfFalse removes the value on top of the stack and continues at instruction A if it is not truthy.
+	OpJumpIfFalse
+	// OpClosure pushes function A, closed over the current frame.
+	OpClosure
+	// OpCall removes the value on top of the stack and calls it with the arguments of call site A.
+	OpCall
+	// OpEndArgument ends the code of an argument.
+	OpEndArgument
+	// OpReturn returns the value on top of the stack from the current function.
+	OpReturn
+	// OpBuiltin calls builtin A with the top B values of the stack as its arguments.
+	OpBuiltin
+	// OpIntAdd adds the top A values of the stack.
+	OpIntAdd
+	// OpIntSubtract subtracts the top A values of the stack from the first of them.
+	OpIntSubtract
+	// OpCheckParameter checks the value of parameter A against its declared type.
+	OpCheckParameter
+	// OpGuard removes the value on top of the stack and fails the call if it is not truthy.
+	OpGuard
+	// OpEqual removes the top two values of the stack and pushes whether they are equal.
+	OpEqual
+	// OpIsNone pushes whether slot A holds none.
+	OpIsNone
+	// OpUnwrapSome pushes whether slot A holds a some, and if so stores its value in slot B.
+	OpUnwrapSome
+	// OpUnwrapOk pushes whether slot A holds an ok result, and if so stores its value in slot B.
+	OpUnwrapOk
+	// OpUnwrapError pushes whether slot A holds an error result, and if so stores its value in slot B.
+	OpUnwrapError
+	// OpCheckOption fails with message constant B if slot A holds an option.
+	OpCheckOption
+	// OpUnwrapList pushes whether slot A holds a list of C elements, and if so stores them in the slots starting at B.
+	OpUnwrapList
+	// OpUnwrapCons pushes whether slot A holds a list that is not empty, and if so stores its first element in slot B and the rest of the list in slot B+1.
+	OpUnwrapCons
+	// OpUnwrapStruct pushes whether slot A holds an instance of the struct definition in constant C, and if so stores its fields in the slots starting at B.
+	OpUnwrapStruct
+	// OpFail fails with message constant A.
+	OpFail
+	// OpImport binds the names imported by import constant A in the environment, and pushes none.
+	OpImport
+)
+
+// instruction is a single instruction of the virtual machine with its operands, and the position of the expression it was compiled from.
+type instruction struct {
+	Op       Opcode
+	A        int
+	B        int
+	C        int
+	Position *Position
+}
+
+// callSite is a call to a function, procedure or struct. The code of each argument starts at one of Arguments and ends with OpEndArgument, after which the call continues at End. A tail call returns its result right away.
+type callSite struct {
+	Name      string
+	Position  *Position
+	Arguments []int
+	End       int
+	Tail      bool
+}
+
+// vmFunction is a compiled function, procedure, or the top level of a program.
+type vmFunction struct {
+	Kind        ValueType
+	Parameters  []Parameter
+	Guard       Value
+	Definition  string
+	ReturnCheck ReturnCheck
+	// Strict reports for each parameter whether its argument is always evaluated, in which case it is evaluated before the call.
+	Strict []bool
+
+	Code      []instruction
+	Constants []Value
+	Names     []string
+	Functions []*vmFunction
+	CallSites []callSite
+	Slots     int
+}
+
+// Program is an expression compiled to bytecode for the virtual machine.
+type Program struct {
+	main *vmFunction
+	env  *Environment
+}
+
+// vmQuoted reports whether the argument at the index of a call to the builtin is passed as it is written instead of evaluated.
+func vmQuoted(
+	name string,
+	index int,
+) bool {
+	quoted := builtins[name].Quoted
+	return quoted != nil && quoted(index)
+}
+
+// Compile compiles an expression returned by Parse to bytecode that evaluates it in the environment. Names that are not bound in the expression itself are looked up in the environment when the program runs, while the builtins are resolved when it is compiled. The virtual machine does not support every expression, for example an import inside a function, in which case an error is returned and the expression can be evaluated with Evaluate instead.
+func Compile(
+	expression Value,
+	env *Environment,
+) (
+	*Program,
+	error,
+) {
+	c := &compiler{
+		env: env,
+		function: &vmFunction{
+			Kind: Procedure,
+		},
+		scope: newCompileScope(nil),
+	}
+	if err := c.compile(expression); err != nil {
+		return nil, err
+	}
+	c.emit(OpReturn, 0, 0, expression.Position)
+	c.function.markTailCalls()
+	return &Program{
+		main: c.function,
+		env:  env,
+	}, nil
+}
+
+// compiler compiles the body of a single function. Functions defined inside it have a compiler of their own, whose outer compiler it is.
+type compiler struct {
+	env      *Environment
+	function *vmFunction
+	scope    *compileScope
+	outer    *compiler
+}
+
+// compileScope maps the names bound in part of a function to their slots. Match clauses have a scope of their own within the function.
+type compileScope struct {
+	names map[string]int
+	outer *compileScope
+}
+
+func newCompileScope(
+	outer *compileScope,
+) *compileScope {
+	return &compileScope{
+		names: make(map[string]int),
+		outer: outer,
+	}
+}
+
+// resolve returns how many functions up a name is bound and its slot. It reports false if the name is not bound in the program, in which case it is looked up in the environment.
+func (
+	c *compiler,
+) resolve(
+	name string,
+) (
+	int,
+	int,
+	bool,
+) {
+	depth := 0
+	for function := c; function != nil; function = function.outer {
+		for scope := function.scope; scope != nil; scope = scope.outer {
+			if slot, ok := scope.names[name]; ok {
+				return depth, slot, true
+			}
+		}
+		depth++
+	}
+	return 0, 0, false
+}
+
+// builtin returns the builtin a name refers to, if it is not bound in the program.
+func (
+	c *compiler,
+) builtin(
+	name string,
+) (
+	Value,
+	bool,
+) {
+	if _, _, ok := c.resolve(name); ok {
+		return Value{}, false
+	}
+	value, err := c.env.Get(name)
+	if err != nil {
+		return Value{}, false
+	}
+	_, ok := value.Data.(func([]Value, *Environment) (Value, error))
+	return value, ok
+}
+
+// isTopLevel reports whether definitions are bound in the environment rather than in a slot.
+func (
+	c *compiler,
+) isTopLevel() bool {
+	return c.outer == nil && c.scope.outer == nil
+}
+
+func (
+	c *compiler,
+) emit(
+	op Opcode,
+	a int,
+	b int,
+	position *Position,
+) int {
+	c.function.Code = append(c.function.Code, instruction{
+		Op:       op,
+		A:        a,
+		B:        b,
+		Position: position,
+	})
+	return len(c.function.Code) - 1
+}
+
+// patch makes the jump at the given instruction continue at the next instruction to be emitted.
+func (
+	c *compiler,
+) patch(
+	jump int,
+) {
+	c.function.Code[jump].A = len(c.function.Code)
+}
+
+func (
+	c *compiler,
+) constant(
+	value Value,
+) int {
+	c.function.Constants = append(c.function.Constants, value)
+	return len(c.function.Constants) - 1
+}
+
+func (
+	c *compiler,
+) name(
+	name string,
+) int {
+	for index, existing := range c.function.Names {
+		if existing == name {
+			return index
+		}
+	}
+	c.function.Names = append(c.function.Names, name)
+	return len(c.function.Names) - 1
+}
+
+// slot reserves a new slot in the frame of the function.
+func (
+	c *compiler,
+) slot() int {
+	c.function.Slots++
+	return c.function.Slots - 1
+}
+
+// slots reserves a number of slots next to each other, and returns the first.
+func (
+	c *compiler,
+) slots(
+	count int,
+) int {
+	c.function.Slots += count
+	return c.function.Slots - count
+}
+
+// hoist reserves slots for the names defined in the expression, so they can be referred to before their definition like in an environment. Functions, procedures and match clauses have a scope of their own and are skipped.
+func (
+	c *compiler,
+) hoist(
+	expression Value,
+) {
+	if c.isTopLevel() || expression.Type != List || expression.PreventEval {
+		return
+	}
+	list := expression.Data.([]Value)
+	if len(list) == 0 {
+		return
+	}
+	if list[0].Type == Symbol {
+		switch list[0].Data.(string) {
+		case "function", "procedure":
+			return
+		case "match":
+			c.hoist(list[1])
+			return
+		case "define":
+			if len(list) == 3 && list[1].Type == Symbol {
+				if _, ok := c.scope.names[list[1].Data.(string)]; !ok {
+					c.scope.names[list[1].Data.(string)] = c.slot()
+				}
+			}
+		}
+	}
+	for _, elem := range list {
+		c.hoist(elem)
+	}
+}
+
+// compile emits the code of an expression, which leaves its value on the stack.
+func (
+	c *compiler,
+) compile(
+	expression Value,
+) error {
+	switch expression.Type {
+	case Bool, Fixed, Float, Function, Int, Option, Procedure, Result, String, Struct, StructDefinition:
+		c.emit(OpConstant, c.constant(expression), 0, expression.Position)
+		return nil
+
+	case Symbol:
+		name := expression.Data.(string)
+		if depth, slot, ok := c.resolve(name); ok {
+			index := c.emit(OpLoadLocal, depth, slot, expression.Position)
+			c.function.Code[index].C = c.name(name)
+			return nil
+		}
+		c.emit(OpLoadGlobal, c.name(name), 0, expression.Position)
+		return nil
+
+	case Import:
+		if !c.isTopLevel() {
+			return errors.New("the virtual machine does not support imports inside functions and match clauses")
+		}
+		c.emit(OpImport, c.constant(expression), 0, expression.Position)
+		return nil
+
+	case List:
+		list := expression.Data.([]Value)
+		if expression.PreventEval || len(list) == 0 {
+			if len(list) == 0 {
+				expression = listValue(nil)
+			}
+			c.emit(OpConstant, c.constant(expression), 0, expression.Position)
+			return nil
+		}
+		if list[0].Type == Symbol {
+			if builtin, ok := c.builtin(list[0].Data.(string)); ok {
+				return c.compileBuiltin(expression, list[0].Data.(string), builtin, list[1:])
+			}
+		}
+		return c.compileCall(expression, list[0], list[1:])
+	}
+	return errors.New("the virtual machine does not support " + typeToString(expression.Type) + " expressions")
+}
+
+// compileCall emits a call to a function, procedure or struct. The arguments are compiled after the call, so the called function decides when they are evaluated.
+func (
+	c *compiler,
+) compileCall(
+	expression Value,
+	head Value,
+	args []Value,
+) error {
+	if err := c.compile(head); err != nil {
+		return err
+	}
+	c.function.CallSites = append(c.function.CallSites, callSite{
+		Name:     expressionToString(head),
+		Position: expression.Position,
+	})
+	site := len(c.function.CallSites) - 1
+	c.emit(OpCall, site, 0, expression.Position)
+
+	var starts []int
+	for _, arg := range args {
+		starts = append(starts, len(c.function.Code))
+		if err := c.compile(arg); err != nil {
+			return err
+		}
+		c.emit(OpEndArgument, 0, 0, arg.Position)
+	}
+	c.function.CallSites[site].Arguments = starts
+	c.function.CallSites[site].End = len(c.function.Code)
+	return nil
+}
+
+// compileBuiltin emits a call to a builtin. Special forms are compiled to instructions of their own.
+func (
+	c *compiler,
+) compileBuiltin(
+	expression Value,
+	name string,
+	builtin Value,
+	args []Value,
+) error {
+	switch name {
+	case "define":
+		if len(args) != 2 || args[0].Type != Symbol {
+			return errors.New("define requires a symbol and a value")
+		}
+		definedName := args[0].Data.(string)
+		if err := c.compile(args[1]); err != nil {
+			return err
+		}
+		if c.isTopLevel() {
+			c.emit(OpDefineGlobal, c.name(definedName), 0, expression.Position)
+			return nil
+		}
+		slot, ok := c.scope.names[definedName]
+		if !ok {
+			slot = c.slot()
+			c.scope.names[definedName] = slot
+		}
+		c.emit(OpStoreLocal, slot, 0, expression.Position)
+		return nil
+
+	case "function", "procedure":
+		return c.compileFunction(expression, name, args)
+
+	case "if":
+		if len(args) != 2 && len(args) != 3 {
+			return errors.New("if requires 2 or 3 arguments")
+		}
+		if err := c.compile(args[0]); err != nil {
+			return err
+		}
+		elseJump := c.emit(OpJumpIfFalse, 0, 0, expression.Position)
+		if err := c.compile(args[1]); err != nil {
+			return err
+		}
+		endJump := c.emit(OpJump, 0, 0, expression.Position)
+		c.patch(elseJump)
+		elseExpression := Value{
+			Type: Option,
+			Data: OptionValue{
+				Some: false,
+			},
+		}
+		if len(args) == 3 {
+			elseExpression = args[2]
+		}
+		if err := c.compile(elseExpression); err != nil {
+			return err
+		}
+		c.patch(endJump)
+		return nil
+
+	case "match":
+		return c.compileMatch(expression, args)
+
+	case "and", "or":
+		// An argument that decides the result jumps past the others, to where that result is pushed.
+		var decided []int
+		for _, arg := range args {
+			if err := c.compile(arg); err != nil {
+				return err
+			}
+			if name == "and" {
+				decided = append(decided, c.emit(OpJumpIfFalse, 0, 0, arg.Position))
+				continue
+			}
+			next := c.emit(OpJumpIfFalse, 0, 0, arg.Position)
+			decided = append(decided, c.emit(OpJump, 0, 0, arg.Position))
+			c.patch(next)
+		}
+		c.emit(OpConstant, c.constant(Value{
+			Type: Bool,
+			Data: name == "and",
+		}), 0, expression.Position)
+		endJump := c.emit(OpJump, 0, 0, expression.Position)
+		for _, jump := range decided {
+			c.patch(jump)
+		}
+		c.emit(OpConstant, c.constant(Value{
+			Type: Bool,
+			Data: name == "or",
+		}), 0, expression.Position)
+		c.patch(endJump)
+		return nil
+
+	case "int-add", "int-subtract":
+		for _, arg := range args {
+			if err := c.compile(arg); err != nil {
+				return err
+			}
+		}
+		op := OpIntAdd
+		if name == "int-subtract" {
+			op = OpIntSubtract
+		}
+		c.emit(op, len(args), 0, expression.Position)
+		return nil
+	}
+
+	if _, ok := builtins[name]; !ok {
+		return errors.New("the virtual machine does not support " + name)
+	}
+	for index, arg := range args {
+		if vmQuoted(name, index) {
+			c.emit(OpConstant, c.constant(arg), 0, arg.Position)
+			continue
+		}
+		if err := c.compile(arg); err != nil {
+			return err
+		}
+	}
+	c.emit(OpBuiltin, c.constant(builtin), len(args), expression.Position)
+	return nil
+}
+
+// compileFunction compiles a function or procedure definition into a function of its own, and emits the creation of a closure over the current frame.
+func (
+	c *compiler,
+) compileFunction(
+	expression Value,
+	kind string,
+	args []Value,
+) error {
+	if len(args) == 0 {
+		return errors.New(kind + " requires 2 or 3 arguments")
+	}
+	site := args[0].Position
+	returnType, rest, err := parseReturnType(kind, args)
+	if err != nil {
+		return err
+	}
+	parameters, guard, err := parseParameters(kind, rest[0])
+	if err != nil {
+		return err
+	}
+	body := rest[1]
+
+	definition := signatureToString(kind, returnType, parameters, guard)
+	function := &vmFunction{
+		Kind:       Function,
+		Parameters: parameters,
+		Guard:      guard,
+		Definition: definition,
+		ReturnCheck: ReturnCheck{
+			Type:       returnType,
+			Definition: definition,
+			Position:   site,
+		},
+	}
+	if kind == "procedure" {
+		function.Kind = Procedure
+	}
+	inner := &compiler{
+		env:      c.env,
+		function: function,
+		scope:    newCompileScope(nil),
+		outer:    c,
+	}
+
+	forced := make(map[string]bool)
+	inner.forcedSymbols(body, forced)
+	if guard.Type != Unknown {
+		inner.forcedSymbols(guard, forced)
+	}
+	// A name defined in the body refers to the definition rather than the parameter.
+	defined := newCheckScope(nil, nil)
+	defined.hoist(body)
+	for name := range defined.names {
+		delete(forced, name)
+	}
+	for index, parameter := range parameters {
+		inner.scope.names[parameter.Name] = inner.slot()
+		function.Strict = append(function.Strict, kind == "procedure" || parameter.Type != Unknown || forced[parameter.Name])
+		if parameter.Type != Unknown {
+			inner.emit(OpCheckParameter, index, 0, site)
+		}
+	}
+	if guard.Type != Unknown {
+		if err := inner.compile(guard); err != nil {
+			return err
+		}
+		inner.emit(OpGuard, 0, 0, guard.Position)
+	}
+	inner.hoist(body)
+	if err := inner.compile(body); err != nil {
+		return err
+	}
+	inner.emit(OpReturn, 0, 0, body.Position)
+	function.markTailCalls()
+
+	c.function.Functions = append(c.function.Functions, function)
+	c.emit(OpClosure, len(c.function.Functions)-1, 0, expression.Position)
+	return nil
+}
+
+// markTailCalls marks the call sites that are followed by a return, possibly after jumps out of an if or match.
+func (
+	f *vmFunction,
+) markTailCalls() {
+	for index := range f.CallSites {
+		ip := f.CallSites[index].End
+		for f.Code[ip].Op == OpJump {
+			ip = f.Code[ip].A
+		}
+		f.CallSites[index].Tail = f.Code[ip].Op == OpReturn
+	}
+}
+
+// forcedSymbols adds the names that are always evaluated when the expression is evaluated. Arguments for parameters that are always evaluated do not need to be delayed.
+func (
+	c *compiler,
+) forcedSymbols(
+	expression Value,
+	forced map[string]bool,
+) {
+	switch expression.Type {
+	case Symbol:
+		forced[expression.Data.(string)] = true
+
+	case List:
+		list := expression.Data.([]Value)
+		if expression.PreventEval || len(list) == 0 {
+			return
+		}
+		c.forcedSymbols(list[0], forced)
+		if list[0].Type != Symbol {
+			return
+		}
+		name := list[0].Data.(string)
+		if _, ok := c.builtin(name); !ok {
+			return
+		}
+		switch name {
+		case "define":
+			if len(list) > 1 {
+				c.forcedSymbols(list[len(list)-1], forced)
+			}
+		case "match":
+			// Only the value is always evaluated, a clause may not be taken and its pattern may bind the names in its result.
+			if len(list) > 1 {
+				c.forcedSymbols(list[1], forced)
+			}
+		case "if":
+			if len(list) != 4 {
+				if len(list) > 1 {
+					c.forcedSymbols(list[1], forced)
+				}
+				return
+			}
+			c.forcedSymbols(list[1], forced)
+			thenForced, elseForced := make(map[string]bool), make(map[string]bool)
+			c.forcedSymbols(list[2], thenForced)
+			c.forcedSymbols(list[3], elseForced)
+			for name := range thenForced {
+				if elseForced[name] {
+					forced[name] = true
+				}
+			}
+		case "int-add", "int-subtract":
+			for _, arg := range list[1:] {
+				c.forcedSymbols(arg, forced)
+			}
+		case "and", "or":
+			// Only the first argument is always evaluated.
+			if len(list) > 1 {
+				c.forcedSymbols(list[1], forced)
+			}
+		default:
+			if builtin, ok := builtins[name]; ok && !builtin.Compiled {
+				for index, arg := range list[1:] {
+					if !vmQuoted(name, index) {
+						c.forcedSymbols(arg, forced)
+					}
+				}
+			}
+		}
+	}
+}
+
+// compileMatch compiles a match. The value is kept in a slot that the patterns are tested against, a pattern that does not match jumps to the next clause. Like Evaluate, a wildcard clause is only used when no other clause matches.
+func (
+	c *compiler,
+) compileMatch(
+	expression Value,
+	args []Value,
+) error {
+	if len(args) < 2 {
+		return errors.New("match requires an expression and at least one clause")
+	}
+	if err := c.compile(args[0]); err != nil {
+		return err
+	}
+	subject := c.slot()
+	c.emit(OpStoreLocal, subject, 0, expression.Position)
+	c.emit(OpPop, 0, 0, expression.Position)
+
+	var patterns []Value
+	for _, clause := range args[1:] {
+		clauseList, _ := clause.Data.([]Value)
+		if clause.Type != List || len(clauseList) != 2 {
+			return errors.New("each clause in match must be a list of a pattern and a result")
+		}
+		patterns = append(patterns, clauseList[0])
+	}
+	if err := checkOptionExhaustive(patterns); err != nil {
+		c.emit(OpCheckOption, subject, c.constant(Value{
+			Type: String,
+			Data: err.Error(),
+		}), expression.Position)
+	}
+
+	var endJumps []int
+	var wildcard Value
+	for _, clause := range args[1:] {
+		clauseList := clause.Data.([]Value)
+		if clauseList[0].Type == Symbol && clauseList[0].Data.(string) == "_" {
+			wildcard = clauseList[1]
+			continue
+		}
+
+		outer := c.scope
+		c.scope = newCompileScope(outer)
+		failJumps, err := c.compilePattern(clauseList[0], subject, false)
+		if err != nil {
+			return err
+		}
+		c.hoist(clauseList[1])
+		if err := c.compile(clauseList[1]); err != nil {
+			return err
+		}
+		c.scope = outer
+		endJumps = append(endJumps, c.emit(OpJump, 0, 0, clause.Position))
+		for _, jump := range failJumps {
+			c.patch(jump)
+		}
+	}
+
+	if wildcard.Type == Unknown {
+		wildcard = Value{
+			Type: Option,
+			Data: OptionValue{
+				Some: false,
+			},
+		}
+	}
+	if err := c.compile(wildcard); err != nil {
+		return err
+	}
+	for _, jump := range endJumps {
+		c.patch(jump)
+	}
+	return nil
+}
+
+// compilePattern emits the code that tests the value in the slot against a pattern and binds the symbols in it. It returns the jumps to take when the value does not match.
+func (
+	c *compiler,
+) compilePattern(
+	pattern Value,
+	slot int,
+	nested bool,
+) (
+	[]int,
+	error,
+) {
+	if pattern.Type == Symbol {
+		name := pattern.Data.(string)
+		switch {
+		case name == "_":
+			return nil, nil
+		case name == "none":
+			c.emit(OpIsNone, slot, 0, pattern.Position)
+			return []int{c.emit(OpJumpIfFalse, 0, 0, pattern.Position)}, nil
+		case nested:
+			// The symbol refers to the slot of the value it matched.
+			c.scope.names[name] = slot
+			return nil, nil
+		}
+	}
+
+	if pattern.Type == List && !pattern.PreventEval {
+		patternList := pattern.Data.([]Value)
+		if len(patternList) > 0 && patternList[0].Type == Symbol {
+			head := patternList[0].Data.(string)
+			op, destructuring := map[string]Opcode{
+				"some":  OpUnwrapSome,
+				"ok":    OpUnwrapOk,
+				"error": OpUnwrapError,
+			}[head]
+			if destructuring && len(patternList) == 2 {
+				inner := c.slot()
+				c.emit(op, slot, inner, pattern.Position)
+				jumps := []int{c.emit(OpJumpIfFalse, 0, 0, pattern.Position)}
+				innerJumps, err := c.compilePattern(patternList[1], inner, true)
+				return append(jumps, innerJumps...), err
+			}
+			if head == "list" {
+				return c.compileElementPatterns(OpUnwrapList, slot, len(patternList)-1, patternList[1:], pattern.Position)
+			}
+			if head == "cons" && len(patternList) == 3 {
+				return c.compileElementPatterns(OpUnwrapCons, slot, 0, patternList[1:], pattern.Position)
+			}
+			if value, err := c.env.Get(head); err == nil && value.Type == StructDefinition {
+				fields := len(value.Data.(*StructDefinitionData).Fields)
+				if fields == len(patternList)-1 {
+					return c.compileElementPatterns(OpUnwrapStruct, slot, c.constant(value), patternList[1:], pattern.Position)
+				}
+				// Like Evaluate, the pattern is only an error once it is tested against an instance of the struct.
+				index := c.emit(OpUnwrapStruct, slot, c.slots(fields), pattern.Position)
+				c.function.Code[index].C = c.constant(value)
+				jump := c.emit(OpJumpIfFalse, 0, 0, pattern.Position)
+				c.emit(OpFail, c.constant(Value{
+					Type: String,
+					Data: "incorrect number of fields in struct pattern",
+				}), 0, pattern.Position)
+				return []int{jump}, nil
+			}
+		}
+	}
+
+	index := c.emit(OpLoadLocal, 0, slot, pattern.Position)
+	c.function.Code[index].C = c.name("match")
+	if err := c.compile(pattern); err != nil {
+		return nil, err
+	}
+	c.emit(OpEqual, 0, 0, pattern.Position)
+	return []int{c.emit(OpJumpIfFalse, 0, 0, pattern.Position)}, nil
+}
+
+// compileElementPatterns emits an instruction that tests the value in the slot and stores its elements in slots of their own, followed by the code that matches each element against the pattern in its position. The operand is C of the instruction.
+func (
+	c *compiler,
+) compileElementPatterns(
+	op Opcode,
+	slot int,
+	operand int,
+	patterns []Value,
+	position *Position,
+) (
+	[]int,
+	error,
+) {
+	first := c.slots(len(patterns))
+	index := c.emit(op, slot, first, position)
+	c.function.Code[index].C = operand
+	jumps := []int{c.emit(OpJumpIfFalse, 0, 0, position)}
+	for offset, pattern := range patterns {
+		innerJumps, err := c.compilePattern(pattern, first+offset, true)
+		if err != nil {
+			return nil, err
+		}
+		jumps = append(jumps, innerJumps...)
+	}
+	return jumps, nil
+}
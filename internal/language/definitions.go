@@ -4,11 +4,13 @@ const (
 	STR_LIST_START = "["
 	STR_LIST_END   = "]"
 	STR_STRING     = "'"
+	STR_COMMENT    = "/"
 
 	CHR_LIST_START = '['
 	CHR_LIST_END   = ']'
 	CHR_STRING     = '\''
 	CHR_ESCAPE     = '\\'
+	CHR_COMMENT    = '/'
 )
 
 // ValueType is an enumeration of our Lisp value kinds.
@@ -26,12 +28,65 @@ const (
 	Int
 	Float
 	String
+	Import
+	StructDefinition
+	Struct
+	Result
+	// Fixed is a fixed-point number with 16 fractional bits, its data is an int32.
+	Fixed
 )
 
+// Parameter is a declared parameter of a function or procedure. An untyped parameter has the Unknown type and accepts any value.
+type Parameter struct {
+	Name string
+	Type ValueType
+}
+
+// FunctionData is a function or procedure created by the language, together with its signature.
+type FunctionData struct {
+	Parameters []Parameter
+	Guard      Value
+	ReturnType ValueType
+	Definition string
+	Call       func([]Value, *Environment) (Value, error)
+
+	// compiled is set for functions and procedures created by the virtual machine, so it can call them without going through Call.
+	compiled *vmClosure
+}
+
+// OverloadData is a set of functions or procedures defined under the same name. Which one is called depends on the number and types of the arguments.
+type OverloadData struct {
+	Name       string
+	Candidates []FunctionData
+}
+
+// ReturnCheck is the declared return type of a function or procedure. Definition describes the function and Position is where it is defined, for the error message.
+type ReturnCheck struct {
+	Type       ValueType
+	Definition string
+	Position   *Position
+}
+
+// LazyData is an expression that is evaluated the first time it is needed. Lazy values hold a pointer to it, so every reference to the same thunk shares the result, or the error, once it is forced.
 type LazyData struct {
 	Expression  Value
-	Value       Value
 	Environment *Environment
+	// Value and Err are the concrete result of evaluating the expression, once Forced is set. The expression and environment are then no longer kept.
+	Value  Value
+	Err    error
+	Forced bool
+
+	// Return is checked against the result once it is concrete.
+	Return ReturnCheck
+	// Frame is the call that created the thunk, if it evaluates the body of a function.
+	Frame *StackFrame
+	// Procedure is set if the thunk evaluates the body of a procedure, which is run right away unless the call is in tail position.
+	Procedure bool
+	// Transient is set while only the caller that continues with the thunk refers to it, such as the body of a call. Its value is not kept, so a loop of tail calls does not keep every call alive.
+	Transient bool
+
+	// force evaluates the thunk in place of the expression, for an argument the virtual machine passes to a function it did not compile.
+	force func() (Value, error)
 }
 
 // OptionValue represents an optional value. Instead of using null, we wrap values in an Option.
@@ -40,9 +95,42 @@ type OptionValue struct {
 	Some  bool
 }
 
+// ResultValue represents the outcome of an operation that can fail. Instead of aborting the evaluation, errors are values that can be matched on.
+type ResultValue struct {
+	Value Value
+	Ok    bool
+}
+
+// Field is a field of a struct, every field has a type.
+type Field struct {
+	Name string
+	Type ValueType
+}
+
+// StructDefinitionData lists the fields of a struct. Calling the definition creates an instance of the struct.
+type StructDefinitionData struct {
+	Fields []Field
+}
+
+// StructData is an instance of a struct, it holds a value for each field of its definition in the same order.
+type StructData struct {
+	Definition *StructDefinitionData
+	Values     []Value
+}
+
+// Position is the location of a parsed expression in its file.
+type Position struct {
+	File   string
+	Row    int
+	Column int
+}
+
 // Value is our generic container for interpreter values.
 type Value struct {
 	Data        interface{}
 	Type        ValueType
 	PreventEval bool
+
+	// Position is where the value was parsed from, values created during evaluation have no position.
+	Position *Position
 }
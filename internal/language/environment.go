@@ -6,16 +6,40 @@ import "errors"
 type Environment struct {
 	Values map[string]Value
 	Outer  *Environment
+
+	interpreter *Interpreter
 }
 
-// NewEnv creates a new environment with an optional outer (parent) environment.
+// NewEnv creates a new environment with an optional outer (parent) environment. The environment belongs to the interpreter of the outer environment, without one it gets an interpreter of its own.
 func NewEnv(
 	outer *Environment,
 ) *Environment {
-	return &Environment{
+	env := &Environment{
 		Values: make(map[string]Value),
 		Outer:  outer,
 	}
+	if outer != nil {
+		env.interpreter = outer.interpreter
+	} else {
+		env.interpreter = &Interpreter{
+			Limits: Limits{
+				MaxDepth: DefaultMaxDepth,
+			},
+		}
+	}
+	return env
+}
+
+// newCallEnv creates the environment of a call to a function defined in the outer environment. It belongs to the interpreter of the caller, which is not the one that defined the function if it was imported from a module.
+func newCallEnv(
+	outer *Environment,
+	caller *Environment,
+) *Environment {
+	return &Environment{
+		Values:      make(map[string]Value),
+		Outer:       outer,
+		interpreter: caller.interpreter,
+	}
 }
 
 // Get retrieves a variable's value from the environment.
@@ -43,5 +67,9 @@ func (
 	key string,
 	value Value,
 ) {
+	if thunk, ok := value.Data.(*LazyData); ok {
+		// A stored thunk can be referred to again, so it keeps its value once known.
+		thunk.Transient = false
+	}
 	e.Values[key] = value
 }
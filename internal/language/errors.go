@@ -0,0 +1,92 @@
+package language
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// String returns the position as file:row:column.
+func (
+	p *Position,
+) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Row, p.Column)
+}
+
+// StackFrame is a call to a function or procedure that was being evaluated when an error occurred.
+type StackFrame struct {
+	Name     string
+	Position *Position
+}
+
+// maxStackFrames is the number of calls a runtime error records, the outer calls of deeper stacks are only counted.
+const maxStackFrames = 64
+
+// RuntimeError is an error that occurred during evaluation. It holds the position of the expression that failed and the calls that enclose it, innermost first. Err is the error it was created from, such as a LimitError.
+type RuntimeError struct {
+	Message  string
+	Position *Position
+	Stack    []StackFrame
+	Omitted  int
+	Err      error
+}
+
+func (
+	e *RuntimeError,
+) Error() string {
+	var builder strings.Builder
+	if e.Position != nil {
+		builder.WriteString(e.Position.String() + " ")
+	}
+	builder.WriteString(e.Message)
+	for _, frame := range e.Stack {
+		builder.WriteString("\n  in " + frame.Name)
+		if frame.Position != nil {
+			builder.WriteString(" at " + frame.Position.String())
+		}
+	}
+	if e.Omitted > 0 {
+		builder.WriteString("\n  ... and " + strconv.Itoa(e.Omitted) + " more calls")
+	}
+	return builder.String()
+}
+
+func (
+	e *RuntimeError,
+) Unwrap() error {
+	return e.Err
+}
+
+// runtimeError gives an error the position of the expression that caused it. Errors that already have a position keep it, and the frame is added to their stack instead.
+func runtimeError(
+	err error,
+	position *Position,
+	frame *StackFrame,
+) error {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		// The error is copied as it can be returned again, for example by a module that failed to evaluate.
+		result := &RuntimeError{
+			Message:  runtimeErr.Message,
+			Position: runtimeErr.Position,
+			Stack:    append([]StackFrame{}, runtimeErr.Stack...),
+			Omitted:  runtimeErr.Omitted,
+			Err:      runtimeErr.Err,
+		}
+		if result.Position == nil {
+			result.Position = position
+		}
+		if frame != nil && len(result.Stack) < maxStackFrames {
+			result.Stack = append(result.Stack, *frame)
+		} else if frame != nil {
+			result.Omitted++
+		}
+		return result
+	}
+	return &RuntimeError{
+		Message:  err.Error(),
+		Position: position,
+		Err:      err,
+	}
+}
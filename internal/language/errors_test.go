@@ -0,0 +1,56 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestRuntimeErrors(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	expression, err := Parse(`[define outer
+	[procedure [n]
+		[int-add [inner n] 1]
+	]
+]`, "game", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, err := EvaluateUntilConcrete(expression, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	expression, err = Parse(`[define inner
+	[function [n]
+		[int-add n missing]
+	]
+]`, "library", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, err := EvaluateUntilConcrete(expression, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[outer 1]", "library:3:14 undefined symbol 'missing'\n  in inner at game:3:12\n  in outer at main:1:1"},
+		{"[int-add 1\n  [1 2]]", "main:2:3 first element in list is not a function, procedure or struct"},
+		{"[if]", "main:1:1 if requires 2 or 3 arguments"},
+		{"[function]", "main:1:1 function requires 2 or 3 arguments"},
+		{"[procedure]", "main:1:1 procedure requires 2 or 3 arguments"},
+	}
+	for _, test := range tests {
+		expression, err := Parse(test.input, "main", nil)
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", test.input, err)
+		}
+		_, err = EvaluateUntilConcrete(expression, env)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
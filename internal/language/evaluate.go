@@ -4,68 +4,137 @@ import (
 	"errors"
 )
 
-var evalDepth = 0
-
 // Evaluate evaluates an expression within a given environment.
 func Evaluate(
 	expression Value,
 	env *Environment,
 ) (Value, error) {
-	evalDepth++
-	defer func() {
-		evalDepth--
-	}()
-
-	if evalDepth > 1e9 {
-		return Value{}, errors.New("maximum evaluation depth exceeded")
+	if env != nil {
+		interpreter := env.interpreter
+		defer interpreter.leave()
+		if err := interpreter.enter(); err != nil {
+			return Value{}, err
+		}
 	}
 
 	switch expression.Type {
-	case Bool, Float, Int, Option, String:
+	case Bool, Fixed, Float, Function, Int, Option, Procedure, Result, String, Struct, StructDefinition:
 		return expression, nil
 
 	case Lazy:
-		thunk := expression.Data.(LazyData)
-		value, err := Evaluate(
-			thunk.Expression,
-			thunk.Environment,
-		)
-		if err != nil {
-			return Value{}, err
+		thunk := expression.Data.(*LazyData)
+		if !thunk.Forced {
+			value, err := forceThunk(thunk)
+			if err == nil && value.Type == Lazy {
+				if thunk.Transient {
+					// Nothing else refers to the thunk, the caller continues with the thunk it returned.
+					return value, nil
+				}
+				value, err = EvaluateUntilConcrete(value, thunk.Environment)
+			}
+			var limitErr *LimitError
+			if errors.As(err, &limitErr) {
+				// A limit belongs to the run rather than the expression, a later run can still evaluate it.
+				return Value{}, err
+			}
+			thunk.Value = value
+			thunk.Err = err
+			thunk.Forced = true
+			thunk.Expression = Value{}
+			thunk.Environment = nil
+			thunk.force = nil
 		}
-		expression.Type = value.Type
-		expression.Data = value.Data
+		if thunk.Err != nil {
+			return Value{}, thunk.Err
+		}
+		expression.Type = thunk.Value.Type
+		expression.Data = thunk.Value.Data
+		expression.PreventEval = thunk.Value.PreventEval
 		return expression, nil
 
 	case List:
+		if expression.PreventEval {
+			// The list is data rather than a call.
+			return expression, nil
+		}
 		list := expression.Data.([]Value)
 		if len(list) == 0 {
-			return Value{
-				Type: Option,
-				Data: OptionValue{
-					Some: false,
-				},
-			}, nil
+			// An empty list can not be a call, it is the empty list.
+			return listValue(nil), nil
 		}
-		value, err := Evaluate(
+		value, err := EvaluateUntilConcrete(
 			list[0],
 			env,
 		)
 		if err != nil {
-			return Value{}, err
+			return Value{}, runtimeError(err, expression.Position, nil)
 		}
 
+		if value.Type == StructDefinition {
+			result, err := constructStruct(value.Data.(*StructDefinitionData), list[1:], env)
+			if err != nil {
+				return Value{}, runtimeError(err, expression.Position, nil)
+			}
+			return result, nil
+		}
 		if value.Type != Function && value.Type != Procedure {
-			return Value{}, errors.New("first element in list is not a function or procedure")
+			return Value{}, runtimeError(errors.New("first element in list is not a function, procedure or struct"), expression.Position, nil)
 		}
 
-		if function, ok := value.Data.(func([]Value, *Environment) (Value, error)); ok {
-			return function(list[1:], env)
+		var result Value
+		var frame *StackFrame
+		switch function := value.Data.(type) {
+		case func([]Value, *Environment) (Value, error):
+			result, err = function(list[1:], env)
+		case FunctionData:
+			frame = &StackFrame{
+				Name:     expressionToString(list[0]),
+				Position: expression.Position,
+			}
+			result, err = function.Call(list[1:], env)
+			if guardErr, ok := err.(*guardError); ok {
+				// Only an overload set can recover from a guard that did not pass.
+				err = errors.New(guardErr.Error())
+			}
+		case OverloadData:
+			frame = &StackFrame{
+				Name:     expressionToString(list[0]),
+				Position: expression.Position,
+			}
+			result, err = function.call(list[1:], env)
+		default:
+			err = errors.New("function or procedure is not callable")
+		}
+		if err != nil {
+			return Value{}, runtimeError(err, expression.Position, frame)
 		}
-		return Value{}, errors.New("function or procedure is not callable")
+
+		if result.Type == Lazy && frame != nil {
+			// The body of the function is evaluated later, the frame is kept to report errors in it.
+			thunk := result.Data.(*LazyData)
+			if thunk.Frame == nil {
+				thunk.Frame = frame
+			}
+		}
+		return result, nil
 
 	case Symbol:
-		return env.Get(expression.Data.(string))
+		value, err := env.Get(expression.Data.(string))
+		if err != nil {
+			return Value{}, runtimeError(err, expression.Position, nil)
+		}
+		return value, nil
+
+	case Import:
+		data := expression.Data.(ImportData)
+		value, err := evaluateImport(data, env)
+		if err != nil {
+			return Value{}, runtimeError(err, expression.Position, &StackFrame{
+				Name:     "import " + data.Module.FileName,
+				Position: expression.Position,
+			})
+		}
+		return value, nil
 	}
 
 	return Value{}, errors.New("unknown expression type")
@@ -80,7 +149,7 @@ func EvaluateUntilConcrete(
 	if err != nil {
 		return Value{}, err
 	}
-	for value.Type == Lazy || value.Type == List {
+	for value.Type == Lazy || (value.Type == List && !value.PreventEval) {
 		value, err = Evaluate(value, env)
 		if err != nil {
 			return Value{}, err
@@ -88,3 +157,46 @@ func EvaluateUntilConcrete(
 	}
 	return value, nil
 }
+
+// evaluateStatement evaluates an expression whose value is not returned, such as the value of a definition. Like Evaluate the result of a function can be left to evaluate later, but the body of a procedure is run so its side effects happen when it is called.
+func evaluateStatement(
+	expression Value,
+	env *Environment,
+) (
+	Value,
+	error,
+) {
+	value, err := Evaluate(expression, env)
+	for err == nil && value.Type == Lazy && value.Data.(*LazyData).Procedure {
+		value, err = Evaluate(value, env)
+	}
+	return value, err
+}
+
+// forceThunk evaluates the expression of a thunk and checks the result against its return type.
+func forceThunk(
+	thunk *LazyData,
+) (
+	Value,
+	error,
+) {
+	if thunk.force != nil {
+		return thunk.force()
+	}
+	value, err := Evaluate(
+		thunk.Expression,
+		thunk.Environment,
+	)
+	if err != nil {
+		return Value{}, runtimeError(err, thunk.Expression.Position, thunk.Frame)
+	}
+	value, err = checkReturn(
+		value,
+		thunk.Environment,
+		thunk.Return,
+	)
+	if err != nil {
+		return Value{}, runtimeError(err, thunk.Expression.Position, thunk.Frame)
+	}
+	return value, nil
+}
@@ -8,7 +8,7 @@ import (
 func evaluateOrFail(
 	input string,
 	env *Environment,
-	t *testing.T,
+	t testing.TB,
 ) Value {
 	expression, err := Parse(input, "<test>", nil)
 	if err != nil {
@@ -71,3 +71,385 @@ func TestFibonacci(
 		}
 	}
 }
+
+// evaluateError is a helper that parses and evaluates a source string in the given environment and returns the evaluation error. It fails the test if there is a parse error.
+func evaluateError(
+	input string,
+	env *Environment,
+	t *testing.T,
+) error {
+	expression, err := Parse(input, "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error in input %q: %v", input, err)
+	}
+	_, err = EvaluateUntilConcrete(expression, env)
+	return err
+}
+
+func TestTypedParameters(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail("[define double [function [int n] [int-add n n]]]", env, t)
+	_ = evaluateOrFail("[define label [procedure [string name any] name]]", env, t)
+	_ = evaluateOrFail("[define apply [function [function f x] [f x]]]", env, t)
+	_ = evaluateOrFail("[define three 3]", env, t)
+	_ = evaluateOrFail("[define first [function [list] list]]", env, t)
+	_ = evaluateOrFail("[define named [function [string function] function]]", env, t)
+	_ = evaluateOrFail("[define second [function [int n string] string]]", env, t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[double 2]", "int<4>"},
+		{"[double [int-add 1 2]]", "int<6>"},
+		{"[double three]", "int<6>"},
+		{"[label 'player' 1]", "string<player>"},
+		{"[apply double three]", "int<6>"},
+		{"[first 1]", "int<1>"},
+		{"[named 'f']", "string<f>"},
+		{"[second 1 'two']", "string<two>"},
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[double 'two']", "<test>:1:1 parameter 'n' expects int, got string"},
+		{"[label 1 1]", "<test>:1:1 parameter 'name' expects string, got int"},
+		{"[apply 1 2]", "<test>:1:1 parameter 'f' expects function, got int"},
+		{"[named 1]", "<test>:1:1 parameter 'function' expects string, got int"},
+		{"[procedure [[n] m] n]", "<test>:1:1 procedure parameters must be symbols or types followed by symbols"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestReturnTypes(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail("[define count-down [function int [int n] [match n [0 0] [_ [count-down [int-subtract n 1]]]]]]", env, t)
+	_ = evaluateOrFail("[define identity [function [x] x]]", env, t)
+	_ = evaluateOrFail("[define wrong [function int [x] [identity x]]]", env, t)
+	_ = evaluateOrFail("[define wrong-procedure [procedure string [] 1]]", env, t)
+
+	result := evaluateOrFail("[count-down 10]", env, t)
+	if valueToString(result) != "int<0>" {
+		t.Errorf("expected int<0>, got %s", valueToString(result))
+	}
+	result = evaluateOrFail("[wrong 1]", env, t)
+	if valueToString(result) != "int<1>" {
+		t.Errorf("expected int<1>, got %s", valueToString(result))
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[wrong 'one']", "<test>:1:43 function int [x] must return int, got string, defined at <test>:1:25"},
+		{"[wrong-procedure]", "<test>:1:46 procedure string [] must return string, got int, defined at <test>:1:36"},
+		{"[function number [x] x]", "<test>:1:1 function return type must be a type, got number"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+
+	// The check is deferred until the lazy result is forced.
+	expression, err := Parse("[wrong 'one']", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	lazy, err := Evaluate(expression, env)
+	if err != nil || lazy.Type != Lazy {
+		t.Fatalf("expected a lazy value, got %s and %v", valueToString(lazy), err)
+	}
+	if _, err := EvaluateUntilConcrete(lazy, env); err == nil {
+		t.Errorf("expected an error when forcing the lazy value")
+	}
+}
+
+func TestOverloading(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail("[define describe [function [int n] 'int']]", env, t)
+	_ = evaluateOrFail("[define describe [function [string s] 'string']]", env, t)
+	_ = evaluateOrFail("[define describe [function [a b] 'pair']]", env, t)
+	_ = evaluateOrFail("[define describe [function [int a b] 'int and any']]", env, t)
+	_ = evaluateOrFail("[define describe [function [string s] 'text']]", env, t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[describe 1]", "string<int>"},
+		{"[describe 'one']", "string<text>"},
+		{"[describe 'one' 2]", "string<pair>"},
+		{"[describe [int-add 1 2] 2]", "string<int and any>"},
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+
+	_ = evaluateOrFail("[define ambiguous [function [int a b] 1]]", env, t)
+	_ = evaluateOrFail("[define ambiguous [function [a int b] 2]]", env, t)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[describe true]", "<test>:1:1 no overload of 'describe' accepts (bool); candidates: function [int n], function [a b], function [int a b], function [string s]"},
+		{"[describe]", "<test>:1:1 no overload of 'describe' accepts no arguments; candidates: function [int n], function [a b], function [int a b], function [string s]"},
+		{"[ambiguous 1 2]", "<test>:1:1 ambiguous call to 'ambiguous' with (int int); candidates: function [int a b], function [a int b]"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestGuards(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail("[define is-zero [function [int n] [match n [0 true] [_ false]]]]", env, t)
+	_ = evaluateOrFail("[define classify [function [int n when [is-zero n]] 'zero']]", env, t)
+	_ = evaluateOrFail("[define classify [function [int n when [match n [1 true] [_ false]]] 'one']]", env, t)
+	_ = evaluateOrFail("[define classify [function [string s] 'text']]", env, t)
+	_ = evaluateOrFail("[define only-zero [procedure [n when [is-zero n]] n]]", env, t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[classify 0]", "string<zero>"},
+		{"[classify 1]", "string<one>"},
+		{"[classify 'two']", "string<text>"},
+		{"[only-zero 0]", "int<0>"},
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[classify 2]", "<test>:1:1 no overload of 'classify' accepts (int), the guards of these candidates did not pass: function [int n when [is-zero n]], function [int n when [match n [1 true] [_ false]]]"},
+		{"[only-zero 1]", "<test>:1:1 guard of procedure [n when [is-zero n]] did not pass"},
+		{"[function [int n [is-zero n]] n]", "<test>:1:1 function guard must follow when"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+
+	// A fallback without a guard is used when no guard passes.
+	_ = evaluateOrFail("[define classify [function [int n] 'many']]", env, t)
+	result := evaluateOrFail("[classify 2]", env, t)
+	if valueToString(result) != "string<many>" {
+		t.Errorf("expected string<many>, got %s", valueToString(result))
+	}
+}
+
+// quadrupleDefinition uses its lazy parameter four times, so nested calls evaluate their argument an exponential number of times unless it is shared.
+const quadrupleDefinition = "[define quadruple [function [n] [int-add n n n n]]]"
+
+// The by-name definitions are the baseline for sharing. They take a function that computes the argument, and call it again at every use like an argument that is not shared.
+const (
+	quadrupleByNameDefinition = "[define quadruple-by-name [function [n] [int-add [n] [n] [n] [n]]]]"
+	fibonacciByNameDefinition = `
+		[define calc-fib-by-name
+			[function [n]
+				[match [n]
+					[0 0]
+					[1 1]
+					[_
+						[int-add
+							[calc-fib-by-name [function [] [int-subtract [n] 1]]]
+							[calc-fib-by-name [function [] [int-subtract [n] 2]]]
+						]
+					]
+				]
+			]
+		]
+	`
+)
+
+// benchmarkLazy compares a call that shares its lazy arguments with the same call passing them by name. It reports the steps taken, and the time and memory used, for each.
+func benchmarkLazy(
+	b *testing.B,
+	definitions []string,
+	calls map[string]string,
+	expected string,
+) {
+	for _, name := range []string{"by-need", "by-name"} {
+		b.Run(name, func(
+			b *testing.B,
+		) {
+			interpreter := NewInterpreter()
+			env := interpreter.NewEnv()
+			for _, definition := range definitions {
+				_ = evaluateOrFail(definition, env, b)
+			}
+			call, err := interpreter.Parse(calls[name], "<test>", nil)
+			if err != nil {
+				b.Fatalf("Parse error: %v", err)
+			}
+			if result := evaluateOrFail(calls[name], env, b); valueToString(result) != expected {
+				b.Fatalf("%s = %s, expected %s", calls[name], valueToString(result), expected)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			interpreter.steps = 0
+			for i := 0; i < b.N; i++ {
+				if _, err := EvaluateUntilConcrete(call, env); err != nil {
+					b.Fatalf("Eval error: %v", err)
+				}
+			}
+			b.ReportMetric(float64(interpreter.steps)/float64(b.N), "steps/op")
+		})
+	}
+}
+
+func BenchmarkLazyParameter(
+	b *testing.B,
+) {
+	benchmarkLazy(b, []string{quadrupleDefinition, quadrupleByNameDefinition}, map[string]string{
+		"by-need": "[quadruple [quadruple [quadruple [quadruple [quadruple [quadruple [quadruple [quadruple 1]]]]]]]]",
+		"by-name": "[quadruple-by-name [function [] [quadruple-by-name [function [] [quadruple-by-name [function [] [quadruple-by-name [function [] [quadruple-by-name [function [] [quadruple-by-name [function [] [quadruple-by-name [function [] [quadruple-by-name [function [] 1]]]]]]]]]]]]]]]]",
+	}, "int<65536>")
+}
+
+func BenchmarkLazyFibonacci(
+	b *testing.B,
+) {
+	benchmarkLazy(b, []string{fibonacciDefinition, fibonacciByNameDefinition}, map[string]string{
+		"by-need": "[calc-fib 20]",
+		"by-name": "[calc-fib-by-name [function [] 20]]",
+	}, "int<6765>")
+}
+
+func TestLazySharing(
+	t *testing.T,
+) {
+	interpreter := NewInterpreter()
+	env := interpreter.NewEnv()
+	_ = evaluateOrFail(quadrupleDefinition, env, t)
+
+	// Without sharing the innermost argument alone is evaluated 4^8 times.
+	interpreter.Limits.MaxSteps = 1000
+	expression, err := interpreter.Parse("[quadruple [quadruple [quadruple [quadruple [quadruple [quadruple [quadruple [quadruple 1]]]]]]]]", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	result, err := interpreter.Evaluate(expression, env)
+	if err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	if valueToString(result) != "int<65536>" {
+		t.Errorf("expected int<65536>, got %s", valueToString(result))
+	}
+
+	// A thunk keeps its error, but not an exceeded limit, which belongs to the run.
+	failing, err := interpreter.Parse("[int-add 1 missing]", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	thunk := Value{
+		Type: Lazy,
+		Data: &LazyData{
+			Expression:  failing,
+			Environment: env,
+		},
+	}
+	_, first := interpreter.Evaluate(thunk, env)
+	_, second := interpreter.Evaluate(thunk, env)
+	if first == nil || first != second {
+		t.Errorf("expected the same error twice, got %v and %v", first, second)
+	}
+
+	interpreter.Limits.MaxSteps = 2
+	limited := Value{
+		Type: Lazy,
+		Data: &LazyData{
+			Expression:  expression,
+			Environment: env,
+		},
+	}
+	if _, err := interpreter.Evaluate(limited, env); err == nil {
+		t.Fatalf("expected the step limit to be exceeded")
+	}
+	interpreter.Limits.MaxSteps = 0
+	result, err = interpreter.Evaluate(limited, env)
+	if err != nil || valueToString(result) != "int<65536>" {
+		t.Errorf("expected int<65536> once the limit is raised, got %s, %v", valueToString(result), err)
+	}
+}
+
+func TestProcedureCalls(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"setup": `
+			[define fail [procedure [] [int-add 1 'one']]]
+			[fail]
+		`,
+	}
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	_ = evaluateOrFail("[define fail [procedure [] [int-add 1 'one']]]", env, t)
+
+	// A procedure that is not called in tail position runs when it is called, even if its result is never used.
+	inputs := []string{
+		"[define failed [fail]]",
+		"[define failed [if true [fail] 1]]",
+		"[import 'setup']",
+	}
+	for _, input := range inputs {
+		expression, err := Parse(input, "<test>", mapResolver(files))
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", input, err)
+		}
+		if _, err := Evaluate(expression, env); err == nil {
+			t.Errorf("For %s: expected the procedure to fail", input)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package language
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFixedLiterals(
+	t *testing.T,
+) {
+	// Every fraction prints as a decimal that parses back to it.
+	for _, integer := range []int64{0, 1, -1, 32767, -32768} {
+		for fraction := int64(0); fraction < fixedOne; fraction++ {
+			raw := integer*fixedOne + fraction
+			if raw > math.MaxInt32 || raw < math.MinInt32 {
+				continue
+			}
+			text := fixedToString(int32(raw)) + "x"
+			parsed, err := parseFixed(text)
+			if err != nil || parsed != int32(raw) {
+				t.Fatalf("%d printed as %s parsed as %d, %v", raw, text, parsed, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5x", "fixed<1.5>"},
+		{"-0.25x", "fixed<-0.25>"},
+		{"3x", "fixed<3>"},
+		{"0.1x", "fixed<0.1>"},
+		{"32767.99999x", "fixed<32767.99998>"},
+		{"-32768x", "fixed<-32768>"},
+	}
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		if valueToString(result) != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+		}
+	}
+
+	if _, err := Parse("32768x", "<test>", nil); err == nil {
+		t.Errorf("expected an error for a literal out of range")
+	}
+}
+
+func TestFixedArithmetic(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[fixed-add 1.5x 2.25x]", "fixed<3.75>"},
+		{"[fixed-add 32767x 1x]", "fixed<-32768>"},
+		{"[fixed-subtract 1x 0.25x 0.25x]", "fixed<0.5>"},
+		{"[fixed-multiply 1.5x -2x]", "fixed<-3>"},
+		{"[fixed-multiply]", "fixed<1>"},
+		{"[fixed-divide 1x 3x]", "ok<fixed<0.33333>>"},
+		{"[fixed-divide -1x 4x]", "ok<fixed<-0.25>>"},
+		{"[fixed-divide 1x 0x]", "error<string<division by zero>>"},
+		{"[fixed-sin 0x]", "fixed<0>"},
+		{"[fixed-cos 0x]", "fixed<1>"},
+		{"[fixed-sin 1.5707963x]", "fixed<1>"},
+		{"[fixed-cos 3.1415926x]", "fixed<-1>"},
+		{"[fixed-sin 0.5x]", "fixed<0.47943>"},
+		{"[fixed-atan2 1x 1x]", "fixed<0.7854>"},
+		{"[fixed-atan2 0x -1x]", "fixed<3.14159>"},
+		{"[fixed-atan2 -1x 0x]", "fixed<-1.5708>"},
+		{"[int-to-fixed -3]", "fixed<-3>"},
+		{"[int-to-fixed 32767]", "fixed<32767>"},
+		{"[int-to-fixed -32768]", "fixed<-32768>"},
+		{"[fixed-to-int -2.75x]", "int<-2>"},
+		{"[float-to-fixed 0.1]", "fixed<0.1>"},
+		{"[float-to-fixed 1.0e9]", "fixed<32767.99998>"},
+		{"[fixed-to-float 0.5x]", "float<0.5>"},
+		{"[match 0.5x [0.5x 'half'] [_ 'other']]", "string<half>"},
+		{"[[function fixed [fixed n] [fixed-multiply n 0.5x]] 3x]", "fixed<1.5>"},
+	}
+
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	for _, test := range tests {
+		for _, result := range []Value{evaluateOrFail(test.input, env, t), runOrFail(test.input, env, t)} {
+			if valueToString(result) != test.expected {
+				t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[fixed-add 1x 1.0]", "<test>:1:1 arguments to fixed-add must be fixed-point numbers"},
+		{"[fixed-sin 1x 2x]", "<test>:1:1 fixed-sin requires 1 argument"},
+		{"[fixed-divide 1x]", "<test>:1:1 fixed-divide requires 2 arguments"},
+		{"[int-to-fixed 40000]", "<test>:1:1 fixed-point number 40000 is out of range"},
+		{"[int-to-fixed -32769]", "<test>:1:1 fixed-point number -32769 is out of range"},
+		{"[fixed-to-float 1]", "<test>:1:1 arguments to fixed-to-float must be fixed-point numbers"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestFixedTrigonometry(
+	t *testing.T,
+) {
+	// The results are within a few units of the last place of the exact values.
+	const tolerance = 4.0 / fixedOne
+	for raw := int64(-8 * fixedOne); raw <= 8*fixedOne; raw += 97 {
+		angle := float64(raw) / fixedOne
+		cos, sin := cordicRotate(raw << cordicShift)
+		if got := float64(fromCordic(sin)) / fixedOne; math.Abs(got-math.Sin(angle)) > tolerance {
+			t.Fatalf("sin %v = %v, expected %v", angle, got, math.Sin(angle))
+		}
+		if got := float64(fromCordic(cos)) / fixedOne; math.Abs(got-math.Cos(angle)) > tolerance {
+			t.Fatalf("cos %v = %v, expected %v", angle, got, math.Cos(angle))
+		}
+	}
+	for y := int64(-3 * fixedOne); y <= 3*fixedOne; y += 4099 {
+		for x := int64(-3 * fixedOne); x <= 3*fixedOne; x += 4099 {
+			if x == 0 && y == 0 {
+				continue
+			}
+			got := float64(fromCordic(cordicAngle(x<<cordicShift, y<<cordicShift))) / fixedOne
+			if expected := math.Atan2(float64(y), float64(x)); math.Abs(got-expected) > tolerance {
+				t.Fatalf("atan2 %d %d = %v, expected %v", y, x, got, expected)
+			}
+		}
+	}
+}
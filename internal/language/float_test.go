@@ -0,0 +1,68 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestFloatArithmetic(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[float-add 1.5 2.25]", "float<3.75>"},
+		{"[float-add]", "float<0>"},
+		{"[float-subtract 5.0 1.5 1.0]", "float<2.5>"},
+		{"[float-subtract 5.0]", "float<5>"},
+		{"[float-multiply 1.5 4.0]", "float<6>"},
+		{"[float-divide 1.0 4.0]", "float<0.25>"},
+		{"[float-divide 1.0 0.0]", "float<+Inf>"},
+		{"[float-divide -1.0 0.0]", "float<-Inf>"},
+		{"[float-floor -1.5]", "float<-2>"},
+		{"[float-ceil -1.5]", "float<-1>"},
+		{"[float-round 2.5]", "float<3>"},
+		{"[float-round -2.5]", "float<-3>"},
+		{"[float-sqrt 2.25]", "float<1.5>"},
+		{"[float-sqrt -1.0]", "float<NaN>"},
+		{"[float-sin 0.0]", "float<0>"},
+		{"[float-cos 0.0]", "float<1>"},
+		{"[float-atan2 1.0 0.0]", "float<1.5707963267948966>"},
+		{"[float-atan2 0.0 -1.0]", "float<3.141592653589793>"},
+		{"[int-to-float 3]", "float<3>"},
+		{"[float-to-int 2.9]", "int<2>"},
+		{"[float-to-int -2.9]", "int<-2>"},
+		{"[float-to-int 1.0e300]", "int<9223372036854775807>"},
+		{"[float-to-int -1.0e300]", "int<-9223372036854775808>"},
+		{"[float-to-int [float-sqrt -1.0]]", "int<0>"},
+		{"[int-add [float-to-int [float-round 1.6]] 1]", "int<3>"},
+	}
+
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	for _, test := range tests {
+		for _, result := range []Value{evaluateOrFail(test.input, env, t), runOrFail(test.input, env, t)} {
+			if valueToString(result) != test.expected {
+				t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[float-add 1.0 2]", "<test>:1:1 arguments to float-add must be floats"},
+		{"[int-add 1 2.0]", "<test>:1:1 arguments to int-add must be integers"},
+		{"[float-sqrt 1.0 2.0]", "<test>:1:1 float-sqrt requires 1 argument"},
+		{"[float-atan2 1.0]", "<test>:1:1 float-atan2 requires 2 arguments"},
+		{"[int-to-float 1.0]", "<test>:1:1 arguments to int-to-float must be integers"},
+		{"[float-to-int 1]", "<test>:1:1 arguments to float-to-int must be floats"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
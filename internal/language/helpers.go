@@ -1,6 +1,9 @@
 package language
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
 // typeToString returns a string representation of a Type.
 func typeToString(
@@ -9,10 +12,14 @@ func typeToString(
 	switch t {
 	case Bool:
 		return "bool"
+	case Fixed:
+		return "fixed"
 	case Float:
 		return "float"
 	case Function:
 		return "function"
+	case Import:
+		return "import"
 	case Int:
 		return "int"
 	case Lazy:
@@ -23,14 +30,150 @@ func typeToString(
 		return "option"
 	case Procedure:
 		return "procedure"
+	case Result:
+		return "result"
 	case String:
 		return "string"
+	case Struct:
+		return "struct"
+	case StructDefinition:
+		return "struct-definition"
 	case Symbol:
 		return "symbol"
 	}
 	return "unknown"
 }
 
+// parameterTypes maps the type names that can be used in parameter lists and struct fields to their Type.
+var parameterTypes = map[string]ValueType{
+	"bool":      Bool,
+	"fixed":     Fixed,
+	"float":     Float,
+	"function":  Function,
+	"int":       Int,
+	"integer":   Int,
+	"list":      List,
+	"option":    Option,
+	"procedure": Procedure,
+	"result":    Result,
+	"string":    String,
+	"struct":    Struct,
+}
+
+// signatureToString returns a string representation of the signature of a function or procedure.
+func signatureToString(
+	kind string,
+	returnType ValueType,
+	parameters []Parameter,
+	guard Value,
+) string {
+	result := kind + " "
+	if returnType != Unknown {
+		result += typeToString(returnType) + " "
+	}
+	result += "["
+	for i, parameter := range parameters {
+		if i > 0 {
+			result += " "
+		}
+		if parameter.Type != Unknown {
+			result += typeToString(parameter.Type) + " "
+		}
+		result += parameter.Name
+	}
+	if guard.Type != Unknown {
+		if len(parameters) > 0 {
+			result += " "
+		}
+		result += "when " + expressionToString(guard)
+	}
+	return result + "]"
+}
+
+// expressionToString returns an expression as it would be written in the source.
+func expressionToString(
+	expression Value,
+) string {
+	switch expression.Type {
+	case Bool:
+		if expression.Data.(bool) {
+			return "true"
+		}
+		return "false"
+
+	case Float:
+		return strconv.FormatFloat(expression.Data.(float64), 'g', -1, 64)
+
+	case Fixed:
+		return fixedToString(expression.Data.(int32)) + "x"
+
+	case Int:
+		return strconv.FormatInt(expression.Data.(int64), 10)
+
+	case List:
+		list := expression.Data.([]Value)
+		result := STR_LIST_START
+		for i, elem := range list {
+			if i > 0 {
+				result += " "
+			}
+			result += expressionToString(elem)
+		}
+		return result + STR_LIST_END
+
+	case String:
+		return STR_STRING + expression.Data.(string) + STR_STRING
+
+	case Symbol:
+		return expression.Data.(string)
+
+	default:
+		return valueToString(expression)
+	}
+}
+
+// okValue wraps a value in a successful result.
+func okValue(
+	value Value,
+) Value {
+	return Value{
+		Type: Result,
+		Data: ResultValue{
+			Ok:    true,
+			Value: value,
+		},
+	}
+}
+
+// errorValue wraps a message in a failed result.
+func errorValue(
+	message string,
+) Value {
+	return Value{
+		Type: Result,
+		Data: ResultValue{
+			Ok: false,
+			Value: Value{
+				Type: String,
+				Data: message,
+			},
+		},
+	}
+}
+
+// isTruthy reports whether a value counts as true in a condition. Only false and none are considered false.
+func isTruthy(
+	value Value,
+) bool {
+	if value.Type == Bool {
+		return value.Data.(bool)
+	}
+	if value.Type == Option {
+		return value.Data.(OptionValue).Some
+	}
+	return true
+}
+
 // valueToString returns a string representation of a Value.
 func valueToString(
 	value Value,
@@ -45,14 +188,20 @@ func valueToString(
 	case Float:
 		return fmt.Sprintf("float<%g>", value.Data.(float64))
 
+	case Fixed:
+		return "fixed<" + fixedToString(value.Data.(int32)) + ">"
+
 	case Function:
 		return "function<>"
 
+	case Import:
+		return "import<" + value.Data.(ImportData).Module.FileName + ">"
+
 	case Int:
 		return fmt.Sprintf("int<%d>", value.Data.(int64))
 
 	case Lazy:
-		return "lazy<" + valueToString(value.Data.(LazyData).Expression) + ">" + environmentToString(value.Data.(LazyData).Environment)
+		return "lazy<" + valueToString(value.Data.(*LazyData).Expression) + ">" + environmentToString(value.Data.(*LazyData).Environment)
 
 	case List:
 		list := value.Data.([]Value)
@@ -75,9 +224,38 @@ func valueToString(
 	case Procedure:
 		return "procedure<>"
 
+	case Result:
+		result := value.Data.(ResultValue)
+		if result.Ok {
+			return "ok<" + valueToString(result.Value) + ">"
+		}
+		return "error<" + valueToString(result.Value) + ">"
+
 	case String:
 		return "string<" + value.Data.(string) + ">"
 
+	case Struct:
+		instance := value.Data.(StructData)
+		result := "struct<"
+		for i, field := range instance.Definition.Fields {
+			if i > 0 {
+				result += " "
+			}
+			result += field.Name + "=" + valueToString(instance.Values[i])
+		}
+		return result + ">"
+
+	case StructDefinition:
+		definition := value.Data.(*StructDefinitionData)
+		result := "struct-definition<"
+		for i, field := range definition.Fields {
+			if i > 0 {
+				result += " "
+			}
+			result += typeToString(field.Type) + " " + field.Name
+		}
+		return result + ">"
+
 	case Symbol:
 		return "symbol<" + value.Data.(string) + ">"
 
@@ -115,6 +293,9 @@ func valueEqual(
 		case Float:
 			return a.Data.(float64) == b.Data.(float64)
 
+		case Fixed:
+			return a.Data.(int32) == b.Data.(int32)
+
 		case String:
 			return a.Data.(string) == b.Data.(string)
 
@@ -152,6 +333,34 @@ func valueEqual(
 			}
 			return true
 
+		case Result:
+			aResult := a.Data.(ResultValue)
+			bResult := b.Data.(ResultValue)
+			if aResult.Ok != bResult.Ok {
+				return false
+			}
+			return valueEqual(
+				aResult.Value,
+				bResult.Value,
+				env,
+			)
+
+		case Struct:
+			aStruct := a.Data.(StructData)
+			bStruct := b.Data.(StructData)
+			if aStruct.Definition != bStruct.Definition {
+				return false
+			}
+			for i := range aStruct.Values {
+				if !valueEqual(aStruct.Values[i], bStruct.Values[i], env) {
+					return false
+				}
+			}
+			return true
+
+		case StructDefinition:
+			return a.Data.(*StructDefinitionData) == b.Data.(*StructDefinitionData)
+
 		case Option:
 			aOption := a.Data.(OptionValue)
 			bOption := b.Data.(OptionValue)
@@ -180,7 +389,7 @@ func printEvaluation(
 	env *Environment,
 ) {
 	spaces := ""
-	for i := 0; i < evalDepth; i++ {
+	for i := 0; i < env.interpreter.depth; i++ {
 		spaces += "  "
 	}
 	println(spaces+message, valueToString(value), environmentToString(env))
@@ -190,9 +399,10 @@ func printKeyValue(
 	message string,
 	key string,
 	value *Value,
+	env *Environment,
 ) {
 	spaces := ""
-	for i := 0; i < evalDepth; i++ {
+	for i := 0; i < env.interpreter.depth; i++ {
 		spaces += "  "
 	}
 	if value == nil {
@@ -0,0 +1,980 @@
+package language
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Type is a type inferred for an expression. A type without a name is a type variable, which stands for a type that is not known yet. The any type is given to expressions that can not be typed, such as overloaded functions, and is compatible with every other type.
+type Type struct {
+	Name string
+	// Arguments are the element types of option, list and result types. Of function and procedure types they are the parameter types followed by the result type, and of struct definitions the field types followed by the type of an instance.
+	Arguments []*Type
+	// Parameters are the names of the parameters of a function or procedure, or the fields of a struct definition, if they are known.
+	Parameters []string
+	// Struct is the name of the struct of struct instances.
+	Struct string
+
+	instance *Type
+	level    int
+}
+
+// genericLevel is the level of the type variables of a definition that can be instantiated with a different type at each use.
+const genericLevel = math.MaxInt
+
+// builtinType is the signature of a builtin that evaluates all of its arguments. If Variadic is set any number of arguments of that type is accepted instead of Parameters.
+type builtinType struct {
+	Parameters []*Type
+	Variadic   *Type
+	Result     *Type
+}
+
+// intVariadicType is the signature of a builtin that combines any number of integers.
+func intVariadicType(
+	fresh func() *Type,
+) builtinType {
+	return builtinType{Variadic: namedType("int"), Result: namedType("int")}
+}
+
+// intDivisionType is the signature of a builtin that divides two integers, which fails when dividing by zero.
+func intDivisionType(
+	fresh func() *Type,
+) builtinType {
+	return builtinType{Parameters: []*Type{namedType("int"), namedType("int")}, Result: resultType(namedType("int"), namedType("string"))}
+}
+
+// intFunctionType returns the signature of a builtin of a number of integers with a result of the named type.
+func intFunctionType(
+	count int,
+	result string,
+) func(fresh func() *Type) builtinType {
+	return func(fresh func() *Type) builtinType {
+		parameters := make([]*Type, count)
+		for i := range parameters {
+			parameters[i] = namedType("int")
+		}
+		return builtinType{Parameters: parameters, Result: namedType(result)}
+	}
+}
+
+// listAddType is the signature of a builtin that adds an element to a list.
+func listAddType(
+	fresh func() *Type,
+) builtinType {
+	element := fresh()
+	list := namedType("list", element)
+	return builtinType{Parameters: []*Type{list, element}, Result: list}
+}
+
+// fixedVariadicType is the signature of a builtin that combines any number of fixed-point numbers.
+func fixedVariadicType(
+	fresh func() *Type,
+) builtinType {
+	return builtinType{Variadic: namedType("fixed"), Result: namedType("fixed")}
+}
+
+// fixedFunctionType returns the signature of a builtin of a number of fixed-point numbers that results in a fixed-point number.
+func fixedFunctionType(
+	count int,
+) func(fresh func() *Type) builtinType {
+	return func(fresh func() *Type) builtinType {
+		parameters := make([]*Type, count)
+		for i := range parameters {
+			parameters[i] = namedType("fixed")
+		}
+		return builtinType{Parameters: parameters, Result: namedType("fixed")}
+	}
+}
+
+// floatVariadicType is the signature of a builtin that combines any number of floats.
+func floatVariadicType(
+	fresh func() *Type,
+) builtinType {
+	return builtinType{Variadic: namedType("float"), Result: namedType("float")}
+}
+
+// floatFunctionType returns the signature of a builtin of a number of floats that results in a float.
+func floatFunctionType(
+	count int,
+) func(fresh func() *Type) builtinType {
+	return func(fresh func() *Type) builtinType {
+		parameters := make([]*Type, count)
+		for i := range parameters {
+			parameters[i] = namedType("float")
+		}
+		return builtinType{Parameters: parameters, Result: namedType("float")}
+	}
+}
+
+func namedType(
+	name string,
+	arguments ...*Type,
+) *Type {
+	return &Type{
+		Name:      name,
+		Arguments: arguments,
+	}
+}
+
+func resultType(
+	value *Type,
+	err *Type,
+) *Type {
+	return namedType("result", value, err)
+}
+
+// typeScheme is the type of a name in a type scope. A nil scheme is a name whose type is not known, and is typed as any.
+type typeScheme struct {
+	Type    *Type
+	Builtin bool
+}
+
+// typeScope mirrors an Environment during inference.
+type typeScope struct {
+	names      map[string]*typeScheme
+	overloaded map[string]bool
+	outer      *typeScope
+}
+
+func newTypeScope(
+	outer *typeScope,
+) *typeScope {
+	return &typeScope{
+		names:      make(map[string]*typeScheme),
+		overloaded: make(map[string]bool),
+		outer:      outer,
+	}
+}
+
+// lookup returns the scheme of a name and whether the name is known.
+func (
+	s *typeScope,
+) lookup(
+	name string,
+) (
+	*typeScheme,
+	bool,
+) {
+	for scope := s; scope != nil; scope = scope.outer {
+		if scheme, ok := scope.names[name]; ok {
+			return scheme, true
+		}
+	}
+	return nil, false
+}
+
+// Inference infers the types of expressions without evaluating them. Parameters without a declared type and results of functions are inferred from how they are used. Definitions are remembered, so expressions inferred later can use them, and are generic where possible. Names it does not know about, such as overloaded functions, are given the any type which is compatible with everything.
+type Inference struct {
+	scope       *typeScope
+	modules     map[*ModuleData]*typeScope
+	structs     map[string]*Type
+	structNames []string
+	diagnostics []Diagnostic
+	level       int
+}
+
+// NewInference creates an inference that knows the types of the builtins.
+func NewInference() *Inference {
+	scope := newTypeScope(nil)
+	for name, builtin := range builtins {
+		if builtin.Value.Type == Function {
+			scope.names[name] = &typeScheme{Builtin: true}
+		}
+	}
+	scope.names["none"] = &typeScheme{
+		Type: namedType("option", &Type{level: genericLevel}),
+	}
+	return &Inference{
+		scope:   newTypeScope(scope),
+		modules: make(map[*ModuleData]*typeScope),
+		structs: make(map[string]*Type),
+	}
+}
+
+// Infer infers the type of the expression returned by Parse and reports the type errors it finds, including those in imported modules.
+func (
+	i *Inference,
+) Infer(
+	expression Value,
+) (
+	*Type,
+	[]Diagnostic,
+) {
+	i.diagnostics = nil
+	i.hoist(i.scope, expression)
+	result := i.infer(expression, i.scope)
+	return result, i.diagnostics
+}
+
+// Signature returns the inferred type of a definition.
+func (
+	i *Inference,
+) Signature(
+	name string,
+) (
+	*Type,
+	bool,
+) {
+	scheme, ok := i.scope.lookup(name)
+	if !ok || scheme == nil || scheme.Builtin {
+		return nil, false
+	}
+	return scheme.Type, true
+}
+
+// report adds a diagnostic at the position of the expression.
+func (
+	i *Inference,
+) report(
+	expression Value,
+	message string,
+) {
+	diagnostic := Diagnostic{
+		Message: message,
+	}
+	if expression.Position != nil {
+		diagnostic.File = expression.Position.File
+		diagnostic.Row = expression.Position.Row
+		diagnostic.Column = expression.Position.Column
+	}
+	i.diagnostics = append(i.diagnostics, diagnostic)
+}
+
+func (
+	i *Inference,
+) fresh() *Type {
+	return &Type{
+		level: i.level,
+	}
+}
+
+// hoist prepares the scope for the definitions in the expressions. Names that are defined more than once are overloaded and typed as any, other names are typed as any until their definition has been inferred so they can be referred to before that.
+func (
+	i *Inference,
+) hoist(
+	scope *typeScope,
+	expressions ...Value,
+) {
+	counts := make(map[string]int)
+	var count func(expression Value)
+	count = func(expression Value) {
+		if expression.Type != List || expression.PreventEval {
+			return
+		}
+		list := expression.Data.([]Value)
+		if isForm(expression, "function") || isForm(expression, "procedure") {
+			return
+		}
+		if len(list) == 3 && isForm(expression, "define") && list[1].Type == Symbol {
+			counts[list[1].Data.(string)]++
+		}
+		for _, elem := range list {
+			count(elem)
+		}
+	}
+	for _, expression := range expressions {
+		count(expression)
+	}
+
+	for name, n := range counts {
+		existing, ok := scope.names[name]
+		if n > 1 || (ok && existing != nil && existing.Type != nil && isCallable(existing.Type)) {
+			scope.overloaded[name] = true
+		}
+		if !ok || scope.overloaded[name] {
+			scope.names[name] = nil
+		}
+	}
+}
+
+// isCallable reports whether the type is a function or procedure.
+func isCallable(
+	t *Type,
+) bool {
+	t = resolveType(t)
+	return t.Name == "function" || t.Name == "procedure"
+}
+
+// infer infers the type of an expression evaluated in the scope.
+func (
+	i *Inference,
+) infer(
+	expression Value,
+	scope *typeScope,
+) *Type {
+	switch expression.Type {
+	case Bool:
+		return namedType("bool")
+	case Fixed:
+		return namedType("fixed")
+	case Float:
+		return namedType("float")
+	case Int:
+		return namedType("int")
+	case String:
+		return namedType("string")
+	case Option:
+		return namedType("option", i.fresh())
+
+	case Symbol:
+		scheme, ok := scope.lookup(expression.Data.(string))
+		if !ok || scheme == nil || scheme.Type == nil {
+			return namedType("any")
+		}
+		return i.instantiate(scheme.Type)
+
+	case Import:
+		return i.inferImport(expression.Data.(ImportData), scope)
+
+	case List:
+		list := expression.Data.([]Value)
+		if expression.PreventEval {
+			element := i.fresh()
+			for _, elem := range list {
+				i.expect(elem, element, i.infer(elem, scope), "list element")
+			}
+			return namedType("list", element)
+		}
+		if len(list) == 0 {
+			return namedType("list", i.fresh())
+		}
+		if list[0].Type == Symbol {
+			name := list[0].Data.(string)
+			if scheme, ok := scope.lookup(name); ok && scheme != nil && scheme.Builtin {
+				return i.inferBuiltin(expression, name, list[1:], scope)
+			}
+		}
+		return i.inferCall(expression, i.infer(list[0], scope), list[1:], scope)
+	}
+	return namedType("any")
+}
+
+// expect unifies the type of an expression with the type it is expected to have, and reports an error at the expression if they do not match.
+func (
+	i *Inference,
+) expect(
+	expression Value,
+	expected *Type,
+	actual *Type,
+	context string,
+) {
+	if !unify(expected, actual) {
+		i.report(expression, context+" expects "+typesToString(expected, actual))
+	}
+}
+
+// inferCall infers the type of a call to a function, procedure or struct definition.
+func (
+	i *Inference,
+) inferCall(
+	expression Value,
+	callee *Type,
+	args []Value,
+	scope *typeScope,
+) *Type {
+	argTypes := make([]*Type, len(args))
+	for index, arg := range args {
+		argTypes[index] = i.infer(arg, scope)
+	}
+
+	callee = resolveType(callee)
+	name := expressionToString(expression.Data.([]Value)[0])
+	switch callee.Name {
+	case "any":
+		return namedType("any")
+
+	case "":
+		result := i.fresh()
+		i.expect(expression.Data.([]Value)[0], &Type{
+			Name:      "function",
+			Arguments: append(argTypes, result),
+		}, callee, "call of "+name)
+		return result
+
+	case "function", "procedure", "struct-definition":
+		parameters := callee.Arguments[:len(callee.Arguments)-1]
+		if len(parameters) != len(args) {
+			i.report(expression, fmt.Sprintf("%s expects %d arguments, got %d", name, len(parameters), len(args)))
+			return namedType("any")
+		}
+		for index, parameter := range parameters {
+			context := fmt.Sprintf("argument %d of %s", index+1, name)
+			if index < len(callee.Parameters) {
+				context = "parameter '" + callee.Parameters[index] + "' of " + name
+			}
+			i.expect(args[index], parameter, argTypes[index], context)
+		}
+		return callee.Arguments[len(callee.Arguments)-1]
+	}
+
+	i.report(expression, name+" is not a function, got "+typeString(callee, make(map[*Type]string)))
+	return namedType("any")
+}
+
+// inferBuiltin infers the type of a call to a builtin.
+func (
+	i *Inference,
+) inferBuiltin(
+	expression Value,
+	name string,
+	args []Value,
+	scope *typeScope,
+) *Type {
+	if signature := builtins[name].Type; signature != nil {
+		builtin := signature(i.fresh)
+		for index, arg := range args {
+			parameter := builtin.Variadic
+			if parameter == nil {
+				if index >= len(builtin.Parameters) {
+					// The checker reports the number of arguments.
+					i.infer(arg, scope)
+					continue
+				}
+				parameter = builtin.Parameters[index]
+			}
+			i.expect(arg, parameter, i.infer(arg, scope), fmt.Sprintf("argument %d of %s", index+1, name))
+		}
+		return builtin.Result
+	}
+
+	switch name {
+	case "define":
+		if len(args) != 2 || args[0].Type != Symbol {
+			return namedType("any")
+		}
+		return i.inferDefine(args[0].Data.(string), args[1], scope)
+
+	case "function", "procedure":
+		return i.inferFunction(name, args, scope)
+
+	case "if":
+		if len(args) != 2 && len(args) != 3 {
+			return namedType("any")
+		}
+		i.infer(args[0], scope)
+		thenType := i.infer(args[1], scope)
+		if len(args) == 2 {
+			// The result is either the value of the branch or none.
+			if resolveType(thenType).Name == "option" {
+				return thenType
+			}
+			return namedType("maybe", thenType)
+		}
+		i.expect(args[2], thenType, i.infer(args[2], scope), "else branch of if")
+		return thenType
+
+	case "match":
+		return i.inferMatch(args, scope)
+
+	case "struct-get":
+		if len(args) != 2 {
+			return namedType("any")
+		}
+		instance := resolveType(i.infer(args[0], scope))
+		if args[1].Type == Symbol {
+			if field := i.structField(instance, args[1].Data.(string)); field != nil {
+				return field
+			}
+		}
+		return namedType("any")
+
+	case "struct-set":
+		if len(args) == 0 {
+			return namedType("any")
+		}
+		instance := resolveType(i.infer(args[0], scope))
+		for index := 1; index+1 < len(args); index += 2 {
+			value := i.infer(args[index+1], scope)
+			if args[index].Type != Symbol {
+				continue
+			}
+			if field := i.structField(instance, args[index].Data.(string)); field != nil {
+				i.expect(args[index+1], field, value, "field '"+args[index].Data.(string)+"' of "+instance.Struct)
+			}
+		}
+		return instance
+	}
+	return namedType("any")
+}
+
+// inferDefine infers the type of a definition and binds the name in the scope. The name is bound while its value is inferred so that functions can call themselves.
+func (
+	i *Inference,
+) inferDefine(
+	name string,
+	value Value,
+	scope *typeScope,
+) *Type {
+	if scope.overloaded[name] {
+		i.infer(value, scope)
+		return namedType("any")
+	}
+
+	i.level++
+	recursive := i.fresh()
+	scope.names[name] = &typeScheme{
+		Type: recursive,
+	}
+	var valueType *Type
+	if isForm(value, "struct") {
+		valueType = i.inferStruct(name, value.Data.([]Value)[1:])
+	} else {
+		valueType = i.infer(value, scope)
+	}
+	i.expect(value, recursive, valueType, "definition of "+name)
+	i.level--
+
+	generalise(valueType, i.level)
+	scope.names[name] = &typeScheme{
+		Type: valueType,
+	}
+	return valueType
+}
+
+// inferFunction infers the type of a function or procedure definition.
+func (
+	i *Inference,
+) inferFunction(
+	kind string,
+	args []Value,
+	scope *typeScope,
+) *Type {
+	returnType, rest, err := parseReturnType(kind, args)
+	if err != nil {
+		return namedType("any")
+	}
+	parameters, guard, err := parseParameters(kind, rest[0])
+	if err != nil {
+		return namedType("any")
+	}
+
+	innerScope := newTypeScope(scope)
+	function := &Type{
+		Name: kind,
+	}
+	for _, parameter := range parameters {
+		parameterType := i.typeFromValueType(parameter.Type)
+		innerScope.names[parameter.Name] = &typeScheme{
+			Type: parameterType,
+		}
+		function.Arguments = append(function.Arguments, parameterType)
+		function.Parameters = append(function.Parameters, parameter.Name)
+	}
+	if guard.Type != Unknown {
+		i.infer(guard, innerScope)
+	}
+
+	i.hoist(innerScope, rest[1])
+	result := i.infer(rest[1], innerScope)
+	if returnType != Unknown {
+		i.expect(rest[1], i.typeFromValueType(returnType), result, kind+" result")
+	}
+	function.Arguments = append(function.Arguments, result)
+	return function
+}
+
+// inferStruct infers the type of a struct definition bound to the name. A struct definition is typed as a constructor of its instances.
+func (
+	i *Inference,
+) inferStruct(
+	name string,
+	fields []Value,
+) *Type {
+	definition := &Type{
+		Name: "struct-definition",
+	}
+	for _, field := range fields {
+		fieldList, _ := field.Data.([]Value)
+		if field.Type != List || len(fieldList) != 2 || fieldList[0].Type != Symbol || fieldList[1].Type != Symbol {
+			return namedType("any")
+		}
+		fieldType, ok := parameterTypes[fieldList[0].Data.(string)]
+		if !ok {
+			return namedType("any")
+		}
+		definition.Arguments = append(definition.Arguments, i.typeFromValueType(fieldType))
+		definition.Parameters = append(definition.Parameters, fieldList[1].Data.(string))
+	}
+	definition.Arguments = append(definition.Arguments, &Type{
+		Name:   "struct",
+		Struct: name,
+	})
+	i.structs[name] = definition
+	i.structNames = append(i.structNames, name)
+	return definition
+}
+
+// structField returns the type of a field of a struct instance, or nil if it is not known. If the type of the instance is not known yet it is taken to be the struct defined last with a field of that name.
+func (
+	i *Inference,
+) structField(
+	instance *Type,
+	field string,
+) *Type {
+	instance = resolveType(instance)
+	if instance.Name == "" {
+		for index := len(i.structNames) - 1; index >= 0; index-- {
+			definition := i.structs[i.structNames[index]]
+			for _, name := range definition.Parameters {
+				if name == field {
+					unify(instance, definition.Arguments[len(definition.Arguments)-1])
+					return i.structField(instance, field)
+				}
+			}
+		}
+	}
+	instance = resolveType(instance)
+	if instance.Name != "struct" {
+		return nil
+	}
+	definition, ok := i.structs[instance.Struct]
+	if !ok {
+		return nil
+	}
+	for index, name := range definition.Parameters {
+		if name == field {
+			return definition.Arguments[index]
+		}
+	}
+	return nil
+}
+
+// inferMatch infers the type of a match. The patterns are typed against the value and the results of the clauses have to agree.
+func (
+	i *Inference,
+) inferMatch(
+	args []Value,
+	scope *typeScope,
+) *Type {
+	if len(args) < 2 {
+		return namedType("any")
+	}
+	value := i.infer(args[0], scope)
+	result := i.fresh()
+	for _, clause := range args[1:] {
+		clauseList, _ := clause.Data.([]Value)
+		if clause.Type != List || len(clauseList) != 2 {
+			continue
+		}
+		clauseScope := newTypeScope(scope)
+		i.inferPattern(clauseList[0], value, scope, clauseScope, false)
+		i.hoist(clauseScope, clauseList[1])
+		i.expect(clauseList[1], result, i.infer(clauseList[1], clauseScope), "match clause")
+	}
+	return result
+}
+
+// inferPattern types a match pattern against the type of the value it matches. Symbols inside destructuring patterns are bound in the bindings scope.
+func (
+	i *Inference,
+) inferPattern(
+	pattern Value,
+	value *Type,
+	scope *typeScope,
+	bindings *typeScope,
+	nested bool,
+) {
+	if pattern.Type == Symbol {
+		switch name := pattern.Data.(string); {
+		case name == "_":
+			return
+		case name == "none":
+			i.expect(pattern, namedType("option", i.fresh()), value, "pattern")
+			return
+		case nested:
+			bindings.names[name] = &typeScheme{
+				Type: value,
+			}
+			return
+		}
+	}
+
+	if pattern.Type == List {
+		patternList := pattern.Data.([]Value)
+		if len(patternList) > 0 && patternList[0].Type == Symbol {
+			switch head := patternList[0].Data.(string); {
+			case (head == "some" || head == "ok" || head == "error") && len(patternList) == 2:
+				element := i.fresh()
+				expected := namedType("option", element)
+				if head != "some" {
+					other := i.fresh()
+					expected = resultType(element, other)
+					if head == "error" {
+						expected = resultType(other, element)
+					}
+				}
+				i.expect(pattern, expected, value, "pattern")
+				i.inferPattern(patternList[1], element, scope, bindings, true)
+				return
+
+			case head == "list":
+				element := i.fresh()
+				i.expect(pattern, namedType("list", element), value, "pattern")
+				for _, subpattern := range patternList[1:] {
+					i.inferPattern(subpattern, element, scope, bindings, true)
+				}
+				return
+
+			case head == "cons" && len(patternList) == 3:
+				list := namedType("list", i.fresh())
+				i.expect(pattern, list, value, "pattern")
+				i.inferPattern(patternList[1], list.Arguments[0], scope, bindings, true)
+				i.inferPattern(patternList[2], list, scope, bindings, true)
+				return
+			}
+
+			if definition, ok := i.structs[patternList[0].Data.(string)]; ok && len(definition.Arguments)-1 == len(patternList)-1 {
+				i.expect(pattern, definition.Arguments[len(definition.Arguments)-1], value, "pattern")
+				for index, subpattern := range patternList[1:] {
+					i.inferPattern(subpattern, definition.Arguments[index], scope, bindings, true)
+				}
+				return
+			}
+		}
+	}
+	i.expect(pattern, value, i.infer(pattern, scope), "pattern")
+}
+
+// inferImport infers the types of an imported module the first time it is seen and binds the imported names in the scope.
+func (
+	i *Inference,
+) inferImport(
+	data ImportData,
+	scope *typeScope,
+) *Type {
+	moduleScope, ok := i.modules[data.Module]
+	if !ok {
+		moduleScope = newTypeScope(i.scope.outer)
+		i.modules[data.Module] = moduleScope
+		i.hoist(moduleScope, data.Module.Expressions...)
+		for _, expression := range data.Module.Expressions {
+			i.infer(expression, moduleScope)
+		}
+	}
+
+	for _, name := range data.Names {
+		scheme := moduleScope.names[name]
+		if data.Prefix != "" {
+			name = data.Prefix + "-" + name
+		}
+		scope.names[name] = scheme
+	}
+	return namedType("option", i.fresh())
+}
+
+// typeFromValueType returns the type of a declared parameter, field or result. Untyped parameters get a type variable.
+func (
+	i *Inference,
+) typeFromValueType(
+	valueType ValueType,
+) *Type {
+	switch valueType {
+	case Unknown:
+		return i.fresh()
+	case Bool, Fixed, Float, Int, String:
+		return namedType(typeToString(valueType))
+	case List, Option:
+		return namedType(typeToString(valueType), i.fresh())
+	case Result:
+		return resultType(i.fresh(), i.fresh())
+	}
+	return namedType("any")
+}
+
+// instantiate copies a type, replacing its generic type variables by new ones.
+func (
+	i *Inference,
+) instantiate(
+	t *Type,
+) *Type {
+	variables := make(map[*Type]*Type)
+	var copyType func(t *Type) *Type
+	copyType = func(t *Type) *Type {
+		t = resolveType(t)
+		if t.Name == "" {
+			if t.level != genericLevel {
+				return t
+			}
+			if _, ok := variables[t]; !ok {
+				variables[t] = i.fresh()
+			}
+			return variables[t]
+		}
+		if len(t.Arguments) == 0 {
+			return t
+		}
+		copied := *t
+		copied.Arguments = make([]*Type, len(t.Arguments))
+		for index, argument := range t.Arguments {
+			copied.Arguments[index] = copyType(argument)
+		}
+		return &copied
+	}
+	return copyType(t)
+}
+
+// generalise makes the type variables created at a deeper level than the given one generic.
+func generalise(
+	t *Type,
+	level int,
+) {
+	t = resolveType(t)
+	if t.Name == "" && t.level > level {
+		t.level = genericLevel
+	}
+	for _, argument := range t.Arguments {
+		generalise(argument, level)
+	}
+}
+
+// resolveType follows bound type variables to the type they stand for.
+func resolveType(
+	t *Type,
+) *Type {
+	for t.instance != nil {
+		t = t.instance
+	}
+	return t
+}
+
+// unify makes two types equal by binding type variables, and reports whether that is possible. Functions and procedures unify with each other, as both can be called, and a maybe unifies with an option if its value is that option.
+func unify(
+	a *Type,
+	b *Type,
+) bool {
+	a, b = resolveType(a), resolveType(b)
+	if a == b || a.Name == "any" || b.Name == "any" {
+		return true
+	}
+	if a.Name == "" || b.Name == "" {
+		if a.Name != "" {
+			a, b = b, a
+		}
+		if occursIn(a, b) {
+			return false
+		}
+		adjustLevels(b, a.level)
+		a.instance = b
+		return true
+	}
+
+	if a.Name == "maybe" && b.Name == "option" {
+		a, b = b, a
+	}
+	if a.Name == "option" && b.Name == "maybe" {
+		// A value or none is an option if the value is one.
+		return unify(a, b.Arguments[0])
+	}
+	if a.Name != b.Name && !(isCallable(a) && isCallable(b)) {
+		return false
+	}
+	if a.Struct != b.Struct || len(a.Arguments) != len(b.Arguments) {
+		return false
+	}
+	for index := range a.Arguments {
+		if !unify(a.Arguments[index], b.Arguments[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+// occursIn reports whether the type variable is part of the type, binding it would create an infinite type.
+func occursIn(
+	variable *Type,
+	t *Type,
+) bool {
+	t = resolveType(t)
+	if t == variable {
+		return true
+	}
+	for _, argument := range t.Arguments {
+		if occursIn(variable, argument) {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustLevels lowers the level of the type variables in the type, so they are not generalised before the variable they are bound to.
+func adjustLevels(
+	t *Type,
+	level int,
+) {
+	t = resolveType(t)
+	if t.Name == "" && t.level > level {
+		t.level = level
+	}
+	for _, argument := range t.Arguments {
+		adjustLevels(argument, level)
+	}
+}
+
+func (
+	t *Type,
+) String() string {
+	return typeString(t, make(map[*Type]string))
+}
+
+// typesToString describes an expected and an actual type, using the same names for their type variables.
+func typesToString(
+	expected *Type,
+	actual *Type,
+) string {
+	names := make(map[*Type]string)
+	return typeString(expected, names) + ", got " + typeString(actual, names)
+}
+
+// typeString returns a string representation of a type. Type variables are named a, b, c and so on in the order they appear. Functions and procedures are written like their definitions, for example `function int [int n]`.
+func typeString(
+	t *Type,
+	names map[*Type]string,
+) string {
+	t = resolveType(t)
+	switch t.Name {
+	case "":
+		if _, ok := names[t]; !ok {
+			names[t] = string(rune('a' + len(names)%26))
+		}
+		return names[t]
+
+	case "function", "procedure", "struct-definition":
+		var parameters []string
+		for index, argument := range t.Arguments[:len(t.Arguments)-1] {
+			parameter := nestedTypeString(argument, names)
+			if index < len(t.Parameters) {
+				parameter += " " + t.Parameters[index]
+			}
+			parameters = append(parameters, parameter)
+		}
+		if t.Name == "struct-definition" {
+			return "struct [" + strings.Join(parameters, "] [") + "]"
+		}
+		return t.Name + " " + nestedTypeString(t.Arguments[len(t.Arguments)-1], names) + " [" + strings.Join(parameters, " ") + "]"
+
+	case "struct":
+		return t.Struct
+	}
+
+	if len(t.Arguments) == 0 {
+		return t.Name
+	}
+	var arguments []string
+	for _, argument := range t.Arguments {
+		arguments = append(arguments, nestedTypeString(argument, names))
+	}
+	return t.Name + "<" + strings.Join(arguments, " ") + ">"
+}
+
+// nestedTypeString returns a string representation of a type inside another type, where functions, procedures and struct definitions are put between brackets.
+func nestedTypeString(
+	t *Type,
+	names map[*Type]string,
+) string {
+	switch resolveType(t).Name {
+	case "function", "procedure", "struct-definition":
+		return "[" + typeString(t, names) + "]"
+	}
+	return typeString(t, names)
+}
@@ -0,0 +1,201 @@
+package language
+
+import (
+	"testing"
+)
+
+// inferOrFail is a helper that parses and infers a source string with the given inference and returns the inferred type. It fails the test if there is a parse error or a type error.
+func inferOrFail(
+	input string,
+	inference *Inference,
+	t *testing.T,
+) string {
+	expression, err := Parse(input, "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error in input %q: %v", input, err)
+	}
+	inferred, diagnostics := inference.Infer(expression)
+	if len(diagnostics) > 0 {
+		t.Fatalf("Type errors in input %q: %v", input, diagnostics)
+	}
+	return inferred.String()
+}
+
+func TestInfer(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "int"},
+		{"'text'", "string"},
+		{"[int-add 1 2]", "int"},
+		{"[some 1]", "option<int>"},
+		{"none", "option<a>"},
+		{"[int-divide 1 2]", "result<int string>"},
+		{"[if true 1 2]", "int"},
+		{"[if true 1]", "maybe<int>"},
+		{"[if true [some 1]]", "option<int>"},
+		{"[function [c o] [match [if c o] [[some n] [int-add n 1]] [none 0]]]", "function int [a c option<int> o]"},
+		{"[function [n] [int-add n 1]]", "function int [int n]"},
+		{"[function [a b] [int-less a b]]", "function bool [int a int b]"},
+		{"[function [n] [and [int-greater n 0] [not [int-equal n 5]]]]", "function bool [int n]"},
+		{"[function [angle] [float-to-int [float-cos angle]]]", "function int [float angle]"},
+		{"[function [angle] [fixed-multiply [fixed-sin angle] 2x]]", "function fixed [fixed angle]"},
+		{"[function [xs] [list-get [list-append xs 1] 0]]", "function option<int> [list<int> xs]"},
+		{"[list-concat [] [list 'a']]", "list<string>"},
+		{"[function [x] x]", "function a [a x]"},
+		{"[procedure string [x] x]", "procedure string [string x]"},
+		{"[function [f x] [f [f x]]]", "function a [[function a [a]] f a x]"},
+		{"[function [o] [match o [[some n] [int-add n 1]] [none 0]]]", "function int [option<int> o]"},
+		{"[function [r] [match r [[ok n] n] [[error e] 0]]]", "function int [result<int a> r]"},
+		{"[function [l] [match l [[cons h t] h] [_ 0]]]", "function int [list<int> l]"},
+		{"[define point [struct [int x] [int y]]]", "struct [int x] [int y]"},
+		{"[function [p] [match p [[some [some x]] x] [_ 'none']]]", "function string [option<option<string>> p]"},
+	}
+
+	for _, test := range tests {
+		result := inferOrFail(test.input, NewInference(), t)
+		if result != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, result)
+		}
+	}
+}
+
+func TestInferDefinitions(
+	t *testing.T,
+) {
+	inference := NewInference()
+	definitions := []string{
+		`
+		[define calc-fib
+			[function [n]
+				[match n
+					[0 0]
+					[1 1]
+					[_ [int-add [calc-fib [int-subtract n 1]] [calc-fib [int-subtract n 2]]]]
+				]
+			]
+		]
+		`,
+		"[define identity [function [x] x]]",
+		"[define point [struct [int x] [int y]]]",
+		"[define shift [function [p] [struct-set p x [int-add [struct-get p x] 1]]]]",
+		"[define twice [function [n] [int-add n n]]]",
+		"[define twice [function [string s] s]]",
+	}
+	for _, definition := range definitions {
+		_ = inferOrFail(definition, inference, t)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"calc-fib", "function int [int n]"},
+		{"identity", "function a [a x]"},
+		{"point", "struct [int x] [int y]"},
+		{"shift", "function point [point p]"},
+	}
+	for _, test := range tests {
+		signature, ok := inference.Signature(test.name)
+		if !ok {
+			t.Errorf("For %s: no signature", test.name)
+			continue
+		}
+		if signature.String() != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.name, test.expected, signature)
+		}
+	}
+	if _, ok := inference.Signature("twice"); ok {
+		t.Errorf("Overloaded twice has a signature")
+	}
+
+	uses := []struct {
+		input    string
+		expected string
+	}{
+		{"[calc-fib 10]", "int"},
+		{"[identity 'text']", "string"},
+		{"[identity [some 1]]", "option<int>"},
+		{"[point 1 2]", "point"},
+		{"[struct-get [point 1 2] y]", "int"},
+		{"[twice 'text']", "any"},
+	}
+	for _, use := range uses {
+		result := inferOrFail(use.input, inference, t)
+		if result != use.expected {
+			t.Errorf("For %s: expected %s, got %s", use.input, use.expected, result)
+		}
+	}
+}
+
+func TestInferErrors(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[int-add 1 'two']", "<test>:1:12 argument 2 of int-add expects int, got string"},
+		{"[if true 1 'two']", "<test>:1:12 else branch of if expects int, got string"},
+		{"[int-add 1 [if true 2]]", "<test>:1:12 argument 2 of int-add expects int, got maybe<int>"},
+		{"[[function [n] [int-add n 1]] 'one']", "<test>:1:31 parameter 'n' of [function [n] [int-add n 1]] expects int, got string"},
+		{"[[function [string s] s] 1]", "<test>:1:26 parameter 's' of [function [string s] s] expects string, got int"},
+		{"[function int [s] [some s]]", "<test>:1:19 function result expects int, got option<a>"},
+		{"[function [o] [match o [[some n] [int-add n 1]] [none 'zero']]]", "<test>:1:55 match clause expects int, got string"},
+		{"[function [x] [x x]]", "<test>:1:16 call of x expects function b [a], got a"},
+		{"[1 2]", "<test>:1:1 1 is not a function, got int"},
+		{"[[function [a b] a] 1]", "<test>:1:1 [function [a b] a] expects 2 arguments, got 1"},
+		{"[list 1 'a']", "<test>:1:9 argument 2 of list expects int, got string"},
+	}
+
+	for _, test := range tests {
+		expression, err := Parse(test.input, "<test>", nil)
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", test.input, err)
+		}
+		_, diagnostics := NewInference().Infer(expression)
+		if len(diagnostics) != 1 {
+			t.Errorf("For %s: expected 1 type error, got %v", test.input, diagnostics)
+			continue
+		}
+		if diagnostics[0].String() != test.expected {
+			t.Errorf("For %s: expected %q, got %q", test.input, test.expected, diagnostics[0].String())
+		}
+	}
+}
+
+func TestInferImports(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"math": `
+			[define increment [function [n] [int-add n 1]]]
+			[define wrap [function [x] [some x]]]
+		`,
+	}
+	inference := NewInference()
+	expression, err := Parse("[import 'math' as m]", "<test>", mapResolver(files))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, diagnostics := inference.Infer(expression); len(diagnostics) > 0 {
+		t.Fatalf("Type errors: %v", diagnostics)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[m-increment 1]", "int"},
+		{"[m-wrap 'text']", "option<string>"},
+	}
+	for _, test := range tests {
+		result := inferOrFail(test.input, inference, t)
+		if result != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, result)
+		}
+	}
+}
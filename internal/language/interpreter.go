@@ -0,0 +1,257 @@
+package language
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// DefaultMaxDepth is the maximum evaluation depth of a new interpreter, it stops runaway recursion before the Go stack overflows.
+const DefaultMaxDepth = 100000
+
+// contextInterval is the number of steps between checks of the context of a run.
+const contextInterval = 1024
+
+// Limits bounds the work of a single run of an interpreter. A limit of zero means there is no limit.
+type Limits struct {
+	// MaxSteps is the number of expressions evaluated plus the number of instructions run by the virtual machine.
+	MaxSteps int
+	// MaxDepth is the number of evaluations and calls that can be nested.
+	MaxDepth int
+	// MaxAllocation is the total size of the lists and struct instances created, counted in elements and fields. Strings are not counted, as no builtin builds them.
+	MaxAllocation int
+}
+
+// LimitKind identifies the limit a run exceeded.
+type LimitKind int
+
+const (
+	StepLimit LimitKind = iota
+	DepthLimit
+	AllocationLimit
+	TimeLimit
+)
+
+// LimitError is returned when a run exceeds one of its limits or its context is done. It can be found with errors.As in the error of the run.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int
+	// Err is the error of the context for a time limit.
+	Err error
+}
+
+func (
+	e *LimitError,
+) Error() string {
+	switch e.Kind {
+	case StepLimit:
+		return "maximum number of evaluation steps exceeded (" + strconv.Itoa(e.Limit) + ")"
+	case DepthLimit:
+		return "maximum evaluation depth exceeded (" + strconv.Itoa(e.Limit) + ")"
+	case AllocationLimit:
+		return "maximum allocation exceeded (" + strconv.Itoa(e.Limit) + ")"
+	default:
+		return "evaluation stopped: " + e.Err.Error()
+	}
+}
+
+func (
+	e *LimitError,
+) Unwrap() error {
+	return e.Err
+}
+
+// Interpreter owns everything needed to evaluate programs: the builtins, the modules its programs import, the limits of a run and the state of the evaluation, such as its depth. Every environment belongs to an interpreter, environments created with NewEnv inherit the interpreter of their outer environment. An interpreter evaluates one expression at a time, separate interpreters can evaluate at the same time.
+type Interpreter struct {
+	Builtins *Environment
+	Modules  *ModuleCache
+	Limits   Limits
+
+	mu        sync.Mutex
+	depth     int
+	steps     int
+	allocated int
+	ctx       context.Context
+}
+
+// NewInterpreter creates an interpreter with the builtins and an empty module cache.
+func NewInterpreter() *Interpreter {
+	i := &Interpreter{
+		Limits: Limits{
+			MaxDepth: DefaultMaxDepth,
+		},
+	}
+	i.Builtins = &Environment{
+		Values:      make(map[string]Value),
+		interpreter: i,
+	}
+	AddBuiltins(i.Builtins)
+	i.Modules = &ModuleCache{
+		Builtins:  i.Builtins,
+		modules:   make(map[string]*ModuleData),
+		optimised: make(map[*ModuleData]*optimisedModule),
+	}
+	return i
+}
+
+// NewEnv creates an environment for a program, which contains the builtins.
+func (
+	i *Interpreter,
+) NewEnv() *Environment {
+	return NewEnv(i.Builtins)
+}
+
+// Parse parses a program, the modules it imports are shared with the other programs of the interpreter.
+func (
+	i *Interpreter,
+) Parse(
+	input string,
+	fileName string,
+	resolver ImportResolver,
+) (
+	Value,
+	error,
+) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return ParseWithCache(input, fileName, resolver, i.Modules)
+}
+
+// Evaluate evaluates an expression until it is concrete in an environment of the interpreter.
+func (
+	i *Interpreter,
+) Evaluate(
+	expression Value,
+	env *Environment,
+) (
+	Value,
+	error,
+) {
+	return i.EvaluateContext(context.Background(), expression, env)
+}
+
+// EvaluateContext evaluates an expression like Evaluate, and stops with a time limit error once the context is done.
+func (
+	i *Interpreter,
+) EvaluateContext(
+	ctx context.Context,
+	expression Value,
+	env *Environment,
+) (
+	Value,
+	error,
+) {
+	if env.interpreter != i {
+		return Value{}, errors.New("environment belongs to another interpreter")
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.begin(ctx)
+	defer i.begin(nil)
+	return EvaluateUntilConcrete(expression, env)
+}
+
+// Run runs a program compiled for an environment of the interpreter.
+func (
+	i *Interpreter,
+) Run(
+	program *Program,
+) (
+	Value,
+	error,
+) {
+	return i.RunContext(context.Background(), program)
+}
+
+// RunContext runs a program like Run, and stops with a time limit error once the context is done.
+func (
+	i *Interpreter,
+) RunContext(
+	ctx context.Context,
+	program *Program,
+) (
+	Value,
+	error,
+) {
+	if program.env.interpreter != i {
+		return Value{}, errors.New("program belongs to another interpreter")
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.begin(ctx)
+	defer i.begin(nil)
+	return program.Run()
+}
+
+// begin resets the counters of the limits for a run with the context.
+func (
+	i *Interpreter,
+) begin(
+	ctx context.Context,
+) {
+	i.steps = 0
+	i.allocated = 0
+	i.ctx = ctx
+}
+
+// enter increases the evaluation depth and counts a step, and returns an error if a limit is exceeded.
+func (
+	i *Interpreter,
+) enter() error {
+	i.depth++
+	if i.Limits.MaxDepth > 0 && i.depth > i.Limits.MaxDepth {
+		return &LimitError{
+			Kind:  DepthLimit,
+			Limit: i.Limits.MaxDepth,
+		}
+	}
+	return i.step()
+}
+
+// step counts a step, and returns an error if there are too many or the context of the run is done.
+func (
+	i *Interpreter,
+) step() error {
+	i.steps++
+	if i.Limits.MaxSteps > 0 && i.steps > i.Limits.MaxSteps {
+		return &LimitError{
+			Kind:  StepLimit,
+			Limit: i.Limits.MaxSteps,
+		}
+	}
+	if i.ctx != nil && i.steps%contextInterval == 0 {
+		select {
+		case <-i.ctx.Done():
+			return &LimitError{
+				Kind: TimeLimit,
+				Err:  i.ctx.Err(),
+			}
+		default:
+		}
+	}
+	return nil
+}
+
+// allocate counts the size of a list or struct instance that is created, and returns an error if the total exceeds the maximum.
+func (
+	i *Interpreter,
+) allocate(
+	size int,
+) error {
+	i.allocated += size
+	if i.Limits.MaxAllocation > 0 && i.allocated > i.Limits.MaxAllocation {
+		return &LimitError{
+			Kind:  AllocationLimit,
+			Limit: i.Limits.MaxAllocation,
+		}
+	}
+	return nil
+}
+
+// leave decreases the evaluation depth.
+func (
+	i *Interpreter,
+) leave() {
+	i.depth--
+}
@@ -0,0 +1,354 @@
+package language
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentInterpreters(
+	t *testing.T,
+) {
+	var wait sync.WaitGroup
+	results := make([]string, 4)
+	errs := make([]error, 4)
+	for index := range results {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			interpreter := NewInterpreter()
+			env := interpreter.NewEnv()
+			for _, input := range []string{fibonacciDefinition, "[calc-fib 15]"} {
+				expression, err := interpreter.Parse(input, "<test>", nil)
+				if err != nil {
+					errs[index] = err
+					return
+				}
+				result, err := interpreter.Evaluate(expression, env)
+				if err != nil {
+					errs[index] = err
+					return
+				}
+				results[index] = valueToString(result)
+			}
+			if interpreter.depth != 0 {
+				results[index] = "depth not reset"
+			}
+		}()
+	}
+	wait.Wait()
+
+	for index, result := range results {
+		if errs[index] != nil {
+			t.Errorf("Interpreter %d: %v", index, errs[index])
+			continue
+		}
+		if result != "int<610>" {
+			t.Errorf("Interpreter %d: expected int<610>, got %s", index, result)
+		}
+	}
+}
+
+func TestInterpreterMaxDepth(
+	t *testing.T,
+) {
+	interpreter := NewInterpreter()
+	interpreter.Limits.MaxDepth = 20
+	env := interpreter.NewEnv()
+	for _, input := range []string{fibonacciDefinition, "[calc-fib 20]"} {
+		expression, err := interpreter.Parse(input, "<test>", nil)
+		if err != nil {
+			t.Fatalf("Parse error: %v", err)
+		}
+		_, err = interpreter.Evaluate(expression, env)
+		if input == fibonacciDefinition {
+			if err != nil {
+				t.Fatalf("Eval error: %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "maximum evaluation depth exceeded") {
+			t.Errorf("expected maximum evaluation depth exceeded, got %v", err)
+		}
+	}
+	if interpreter.depth != 0 {
+		t.Errorf("expected depth 0 after an error, got %d", interpreter.depth)
+	}
+
+	other := NewInterpreter()
+	if _, err := other.Evaluate(Value{Type: Int, Data: int64(1)}, env); err == nil {
+		t.Errorf("expected an error for an environment of another interpreter")
+	}
+}
+
+// limitDefinitions loop forever, by recursion, by tail calls and by creating structs.
+var limitDefinitions = []string{
+	"[define loop [procedure [] [int-add [loop] 1]]]",
+	"[define spin [function [int n] [spin [int-add n 1]]]]",
+	"[define cell [struct [int n]]]",
+	"[define fill [function [int n] [fill [struct-get [cell [int-add n 1]] n]]]]",
+}
+
+// limitRun evaluates or compiles and runs an input with an interpreter, and returns the error of the run.
+func limitRun(
+	interpreter *Interpreter,
+	ctx context.Context,
+	input string,
+	compiled bool,
+	t *testing.T,
+) error {
+	env := interpreter.NewEnv()
+	for _, definition := range append(limitDefinitions, input) {
+		expression, err := interpreter.Parse(definition, "<test>", nil)
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", definition, err)
+		}
+		if !compiled {
+			_, err = interpreter.EvaluateContext(ctx, expression, env)
+		} else {
+			program, compileErr := Compile(expression, env)
+			if compileErr != nil {
+				t.Fatalf("Compile error in input %q: %v", definition, compileErr)
+			}
+			_, err = interpreter.RunContext(ctx, program)
+		}
+		if definition != input && err != nil {
+			t.Fatalf("Eval error in input %q: %v", definition, err)
+		}
+		if definition == input {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestInterpreterLimits(
+	t *testing.T,
+) {
+	tests := []struct {
+		limits   Limits
+		input    string
+		expected LimitKind
+	}{
+		{Limits{MaxDepth: DefaultMaxDepth}, "[loop]", DepthLimit},
+		{Limits{MaxSteps: 10000}, "[spin 0]", StepLimit},
+		{Limits{MaxAllocation: 100}, "[fill 0]", AllocationLimit},
+	}
+
+	for _, test := range tests {
+		for _, compiled := range []bool{false, true} {
+			interpreter := NewInterpreter()
+			interpreter.Limits = test.limits
+			err := limitRun(interpreter, context.Background(), test.input, compiled, t)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Kind != test.expected {
+				t.Errorf("For %s (compiled %v): expected limit %d, got %v", test.input, compiled, test.expected, err)
+			}
+		}
+	}
+}
+
+func TestInterpreterLimitsInModules(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"count": `
+			[define count [function [int n] [if [int-equal n 0] 0 [count [int-subtract n 1]]]]]
+			[define counted [int-add [count 5000] 1]]
+		`,
+	}
+	tests := []string{
+		"[import 'count' [count]]",
+		"[[function [] [count 5000]]]",
+	}
+	for _, input := range tests {
+		// The package-level Parse evaluates modules with builtins of their own.
+		expression, err := Parse(tests[0], "<test>", mapResolver(files))
+		if err != nil {
+			t.Fatalf("Parse error: %v", err)
+		}
+		interpreter := NewInterpreter()
+		env := interpreter.NewEnv()
+		if input != tests[0] {
+			if _, err := interpreter.Evaluate(expression, env); err != nil {
+				t.Fatalf("Eval error: %v", err)
+			}
+			expression, err = Parse(input, "<test>", nil)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+		}
+		interpreter.Limits.MaxSteps = 1000
+		_, err = interpreter.Evaluate(expression, env)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Kind != StepLimit {
+			t.Errorf("For %s: expected the step limit to be exceeded, got %v", input, err)
+		}
+
+		// The limit is not remembered by the module.
+		interpreter.Limits.MaxSteps = 0
+		if _, err := interpreter.Evaluate(expression, env); err != nil {
+			t.Errorf("For %s: expected no error without a step limit, got %v", input, err)
+		}
+	}
+}
+
+func TestSharedModuleCache(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"count": `
+			[define count [function [int n] [if [int-equal n 0] 0 [count [int-subtract n 1]]]]]
+			[define counted [count 500]]
+		`,
+	}
+	cache := NewModuleCache()
+	expression, err := ParseWithCache("[import 'count' [counted]]", "<test>", mapResolver(files), cache)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	unlimited := NewInterpreter()
+	if _, err := unlimited.Evaluate(expression, unlimited.NewEnv()); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	// The module was evaluated by another interpreter, its values are still computed under the limits of this one.
+	limited := NewInterpreter()
+	limited.Limits.MaxSteps = 100
+	env := limited.NewEnv()
+	if _, err := limited.Evaluate(expression, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	expression, err = Parse("counted", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	_, err = limited.Evaluate(expression, env)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Kind != StepLimit {
+		t.Errorf("expected the step limit of the importing interpreter, got %v", err)
+	}
+}
+
+func TestInterpreterTimeout(
+	t *testing.T,
+) {
+	for _, compiled := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		interpreter := NewInterpreter()
+		interpreter.Limits = Limits{}
+		err := limitRun(interpreter, ctx, "[spin 0]", compiled, t)
+		cancel()
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Kind != TimeLimit || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("compiled %v: expected a time limit, got %v", compiled, err)
+		}
+	}
+}
+
+func TestTailCalls(
+	t *testing.T,
+) {
+	definitions := []string{
+		"[define count-down [procedure [int n] [match n [0 'done'] [_ [count-down [int-subtract n 1]]]]]]",
+		"[define count-if [function [int n] [if [match n [0 false] [_ true]] [count-if [int-subtract n 1]] 'done']]]",
+		"[define sum [function int [int n int total] [match n [0 total] [_ [sum [int-subtract n 1] [int-add total n]]]]]]",
+		"[define usum [function [n total] [match n [0 total] [_ [usum [int-subtract n 1] [int-add total n]]]]]]",
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[count-down 100000]", "string<done>"},
+		{"[count-if 100000]", "string<done>"},
+		{"[sum 100000 0]", "int<5000050000>"},
+		{"[usum 100000 0]", "int<5000050000>"},
+	}
+
+	for _, compiled := range []bool{false, true} {
+		interpreter := NewInterpreter()
+		// Calls in tail position must not nest, and arguments of a function calling itself must not wait on each other, so a small depth is enough for a hundred thousand of them.
+		interpreter.Limits = Limits{MaxDepth: 50}
+		env := interpreter.NewEnv()
+		for _, definition := range definitions {
+			if compiled {
+				_ = runOrFail(definition, env, t)
+			} else {
+				_ = evaluateOrFail(definition, env, t)
+			}
+		}
+		for _, test := range tests {
+			expression, err := interpreter.Parse(test.input, "<test>", nil)
+			if err != nil {
+				t.Fatalf("Parse error in input %q: %v", test.input, err)
+			}
+			var result Value
+			if compiled {
+				program, compileErr := Compile(expression, env)
+				if compileErr != nil {
+					t.Fatalf("Compile error in input %q: %v", test.input, compileErr)
+				}
+				result, err = interpreter.Run(program)
+			} else {
+				result, err = interpreter.Evaluate(expression, env)
+			}
+			if err != nil {
+				t.Errorf("For %s (compiled %v): %v", test.input, compiled, err)
+				continue
+			}
+			if valueToString(result) != test.expected {
+				t.Errorf("For %s (compiled %v): expected %s, got %s", test.input, compiled, test.expected, valueToString(result))
+			}
+		}
+	}
+}
+
+func TestTailCallMemory(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	// measure returns the memory in use at the end of the loop, after everything that is no longer referred to is freed.
+	var inUse uint64
+	env.Set("measure", Value{
+		Type: Function,
+		Data: func(
+			args []Value,
+			env *Environment,
+		) (
+			Value,
+			error,
+		) {
+			var stats runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			inUse = stats.HeapAlloc
+			return Value{Type: Int, Data: int64(0)}, nil
+		},
+	})
+	_ = evaluateOrFail("[define count-down [function [int n] [match n [0 [measure]] [_ [count-down [int-subtract n 1]]]]]]", env, t)
+	_ = evaluateOrFail("[define sum [function int [int n int total] [match n [0 [measure]] [_ [sum [int-subtract n 1] [int-add total n]]]]]]", env, t)
+	_ = evaluateOrFail("[define usum [function [n total] [match n [0 [measure]] [_ [usum [int-subtract n 1] [int-add total n]]]]]]", env, t)
+
+	tests := []struct {
+		small string
+		large string
+	}{
+		{"[count-down 1000]", "[count-down 200000]"},
+		{"[sum 1000 0]", "[sum 200000 0]"},
+		{"[usum 1000 0]", "[usum 200000 0]"},
+	}
+	for _, test := range tests {
+		_ = evaluateOrFail(test.small, env, t)
+		small := inUse
+		_ = evaluateOrFail(test.large, env, t)
+		// Keeping every call alive costs hundreds of bytes per iteration.
+		if inUse > small+10<<20 {
+			t.Errorf("For %s: expected memory to stay flat, used %d bytes against %d for %s", test.large, inUse, small, test.small)
+		}
+	}
+}
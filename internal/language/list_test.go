@@ -0,0 +1,108 @@
+package language
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLists(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[]", "list<>"},
+		{"[list]", "list<>"},
+		{"[list 1 2 3]", "list<int<1> int<2> int<3>>"},
+		{"[list [int-add 1 1] 'two']", "list<int<2> string<two>>"},
+		{"[list-length []]", "int<0>"},
+		{"[list-length [list 1 2 3]]", "int<3>"},
+		{"[list-get [list 1 2 3] 1]", "some<int<2>>"},
+		{"[list-get [list 1 2 3] 3]", "none<>"},
+		{"[list-get [list 1 2 3] -1]", "none<>"},
+		{"[list-prepend [list 2 3] 1]", "list<int<1> int<2> int<3>>"},
+		{"[list-append [list 1 2] 3]", "list<int<1> int<2> int<3>>"},
+		{"[list-append [] 1]", "list<int<1>>"},
+		{"[list-slice [list 1 2 3] 1 3]", "ok<list<int<2> int<3>>>"},
+		{"[list-slice [list 1 2 3] 1 1]", "ok<list<>>"},
+		{"[list-slice [list 1 2 3] 2 1]", "error<string<slice from 2 to 1 is out of range for a list of length 3>>"},
+		{"[list-slice [list 1 2 3] 0 4]", "error<string<slice from 0 to 4 is out of range for a list of length 3>>"},
+		{"[list-concat]", "list<>"},
+		{"[list-concat [list 1] [] [list 2 3]]", "list<int<1> int<2> int<3>>"},
+		{"[list-length [list-concat numbers numbers]]", "int<6>"},
+		{"[list-get [list-slice-or-empty numbers 1 2] 0]", "some<int<2>>"},
+		{"[list-append [list-slice-or-empty numbers 0 1] 4]", "list<int<1> int<4>>"},
+		{"numbers", "list<int<1> int<2> int<3>>"},
+	}
+	definitions := []string{
+		"[define numbers [list 1 2 3]]",
+		"[define list-slice-or-empty [function [xs start end] [match [list-slice xs start end] [[ok slice] slice] [[error message] []]]]]",
+	}
+
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	for _, definition := range definitions {
+		_ = evaluateOrFail(definition, env, t)
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		if valueToString(result) != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+		}
+	}
+
+	runEnv := NewEnv(nil)
+	AddBuiltins(runEnv)
+	for _, definition := range definitions {
+		_ = runOrFail(definition, runEnv, t)
+	}
+	for _, test := range tests {
+		result := runOrFail(test.input, runEnv, t)
+		if valueToString(result) != test.expected {
+			t.Errorf("For %s (compiled): expected %s, got %s", test.input, test.expected, valueToString(result))
+		}
+	}
+
+	patternTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[match [list 1 2] [[list a b] [int-add a b]] [_ 0]]", "int<3>"},
+		{"[match [list-prepend [] 1] [[cons head tail] head] [_ 0]]", "int<1>"},
+		{"[match [] [[cons head tail] head] [_ 0]]", "int<0>"},
+	}
+	for _, test := range patternTests {
+		result := evaluateOrFail(test.input, env, t)
+		if valueToString(result) != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[list-length 1]", "<test>:1:1 expected a list, got int"},
+		{"[list-get [list 1] 'one']", "<test>:1:1 expected an integer index, got string"},
+		{"[list-append [list 1]]", "<test>:1:1 list-append requires 2 arguments"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+
+	interpreter := NewInterpreter()
+	interpreter.Limits.MaxAllocation = 10
+	expression, err := interpreter.Parse("[list-concat [list 1 2 3 4 5 6] [list 7 8 9 10 11]]", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	_, err = interpreter.Evaluate(expression, interpreter.NewEnv())
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Kind != AllocationLimit {
+		t.Errorf("expected the allocation limit to be exceeded, got %v", err)
+	}
+}
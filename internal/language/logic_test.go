@@ -0,0 +1,64 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestLogic(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[and true true]", "bool<true>"},
+		{"[and true false]", "bool<false>"},
+		{"[and]", "bool<true>"},
+		{"[or false true]", "bool<true>"},
+		{"[or false none]", "bool<false>"},
+		{"[or]", "bool<false>"},
+		{"[and 0 'text' [some false]]", "bool<true>"},
+		{"[and [some 1] none]", "bool<false>"},
+		{"[not false]", "bool<true>"},
+		{"[not none]", "bool<true>"},
+		{"[not 0]", "bool<false>"},
+		{"[and false missing]", "bool<false>"},
+		{"[or true missing]", "bool<true>"},
+		{"[both false missing]", "bool<false>"},
+		{"[if [and [int-greater 2 1] [not [int-equal 2 1]]] 'yes' 'no']", "string<yes>"},
+	}
+
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	_ = evaluateOrFail("[define both [function [a b] [and a b]]]", env, t)
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		if valueToString(result) != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, valueToString(result))
+		}
+	}
+
+	runEnv := NewEnv(nil)
+	AddBuiltins(runEnv)
+	_ = runOrFail("[define both [function [a b] [and a b]]]", runEnv, t)
+	for _, test := range tests {
+		result := runOrFail(test.input, runEnv, t)
+		if valueToString(result) != test.expected {
+			t.Errorf("For %s (compiled): expected %s, got %s", test.input, test.expected, valueToString(result))
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[and true missing]", "<test>:1:11 undefined symbol 'missing'"},
+		{"[not]", "<test>:1:1 not requires 1 argument"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
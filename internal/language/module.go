@@ -0,0 +1,291 @@
+package language
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ModuleData represents an imported file. A module is parsed once and evaluated at most once by each interpreter, in an environment of its own, after which its bindings are re-used by every file that imports it.
+type ModuleData struct {
+	FileName      string
+	Expressions   []Value
+	Definitions   []string
+	Documentation map[string]string
+	// Environment holds the builtins the module sees, the environments it is evaluated in are inside it.
+	Environment *Environment
+
+	// cache is the cache the module was parsed into, which also holds its optimised copy.
+	cache *ModuleCache
+	// mu guards the evaluations, expressions can be added to an optimised module after it was evaluated.
+	mu sync.Mutex
+	// instances holds the evaluation of the module by each interpreter, so the modules of a shared cache do not run under the limits of another interpreter.
+	instances map[*Interpreter]*moduleInstance
+}
+
+// moduleInstance is the evaluation of a module by one interpreter. Expressions before evaluated have been evaluated.
+type moduleInstance struct {
+	Environment *Environment
+	evaluated   int
+	err         error
+}
+
+// ImportData binds the definitions of a module into the environment that evaluates the import. Only the listed names are bound, and if a prefix is given each name is bound as `prefix-name`.
+type ImportData struct {
+	Module *ModuleData
+	Names  []string
+	Prefix string
+}
+
+// ModuleCache keeps track of the modules imported while parsing, so a file imported from several places is shared.
+type ModuleCache struct {
+	Builtins *Environment
+	modules  map[string]*ModuleData
+
+	// optimised holds the optimised copy of each module, so programs that are optimised separately still share the module.
+	mu        sync.Mutex
+	optimised map[*ModuleData]*optimisedModule
+
+	// loading is the chain of imports of the modules that are currently being parsed.
+	loading []importHop
+}
+
+// importHop is a single import statement in a chain of imports.
+type importHop struct {
+	FileName string
+	Row      int
+	Column   int
+	Imports  string
+}
+
+// importCycleError is returned when a file directly or indirectly imports itself.
+type importCycleError struct {
+	Hops []importHop
+}
+
+func (
+	e *importCycleError,
+) Error() string {
+	message := "import cycle detected:"
+	for _, hop := range e.Hops {
+		message += fmt.Sprintf("\n  %s:%d:%d imports %s", hop.FileName, hop.Row, hop.Column, hop.Imports)
+	}
+	return message
+}
+
+// NewModuleCache creates an empty module cache. Modules are evaluated in an environment of their own that only sees the builtins.
+func NewModuleCache() *ModuleCache {
+	builtins := NewEnv(nil)
+	AddBuiltins(builtins)
+	return &ModuleCache{
+		Builtins:  builtins,
+		modules:   make(map[string]*ModuleData),
+		optimised: make(map[*ModuleData]*optimisedModule),
+	}
+}
+
+// get returns a previously parsed module.
+func (
+	c *ModuleCache,
+) get(
+	fileName string,
+) (
+	*ModuleData,
+	bool,
+) {
+	module, ok := c.modules[fileName]
+	return module, ok
+}
+
+// checkCycle returns an error if the import would import a module that is still being parsed.
+func (
+	c *ModuleCache,
+) checkCycle(
+	hop importHop,
+) error {
+	for i, loading := range c.loading {
+		if loading.Imports == hop.Imports {
+			hops := append([]importHop{}, c.loading[i+1:]...)
+			return &importCycleError{
+				Hops: append(hops, hop),
+			}
+		}
+	}
+	return nil
+}
+
+// add parses the contents of a file into a module and stores it in the cache.
+func (
+	c *ModuleCache,
+) add(
+	input string,
+	fileName string,
+	resolver ImportResolver,
+) (
+	*ModuleData,
+	error,
+) {
+	tokens := tokenize(input)
+	documentation := tokenDocumentation(tokens)
+	var expressions []Value
+	for len(tokens) > 0 {
+		var expression Value
+		var err error
+		expression, tokens, err = parseTokens(
+			tokens,
+			fileName,
+			resolver,
+			c,
+		)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+	}
+
+	module := &ModuleData{
+		FileName:      fileName,
+		Expressions:   expressions,
+		Definitions:   moduleDefinitions(expressions),
+		Documentation: documentation,
+		Environment:   NewEnv(c.Builtins),
+		cache:         c,
+	}
+	c.modules[fileName] = module
+	return module, nil
+}
+
+// getOptimised returns the optimised copy of a module, or nil if it has not been optimised yet. A module that is not in a cache is never shared.
+func (
+	c *ModuleCache,
+) getOptimised(
+	module *ModuleData,
+) *optimisedModule {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.optimised[module]
+}
+
+// addOptimised stores the optimised copy of a module. If another copy was stored in the meantime that one is returned instead, so there is only ever one.
+func (
+	c *ModuleCache,
+) addOptimised(
+	module *ModuleData,
+	optimised *optimisedModule,
+) *optimisedModule {
+	if c == nil {
+		return optimised
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.optimised[module]; ok {
+		return existing
+	}
+	c.optimised[module] = optimised
+	return optimised
+}
+
+// moduleDefinitions returns the names defined at the top level of a module.
+func moduleDefinitions(
+	expressions []Value,
+) []string {
+	var definitions []string
+	for _, expression := range expressions {
+		if expression.Type != List {
+			continue
+		}
+		list := expression.Data.([]Value)
+		if len(list) < 2 || list[0].Type != Symbol || list[0].Data.(string) != "define" || list[1].Type != Symbol {
+			continue
+		}
+		definitions = append(definitions, list[1].Data.(string))
+	}
+	return definitions
+}
+
+// defines reports whether the module defines the name at its top level.
+func (
+	m *ModuleData,
+) defines(
+	name string,
+) bool {
+	for _, definition := range m.Definitions {
+		if definition == name {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate evaluates the expressions of the module by the interpreter, and returns the environment of the module for that interpreter. Each expression is only evaluated the first time it is called, later calls return the outcome of the first.
+func (
+	m *ModuleData,
+) evaluate(
+	interpreter *Interpreter,
+) (
+	*Environment,
+	error,
+) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	instance, ok := m.instances[interpreter]
+	if !ok {
+		instance = &moduleInstance{
+			Environment: &Environment{
+				Values:      make(map[string]Value),
+				Outer:       m.Environment,
+				interpreter: interpreter,
+			},
+		}
+		if m.instances == nil {
+			m.instances = make(map[*Interpreter]*moduleInstance)
+		}
+		m.instances[interpreter] = instance
+	}
+	for instance.err == nil && instance.evaluated < len(m.Expressions) {
+		if _, err := evaluateStatement(m.Expressions[instance.evaluated], instance.Environment); err != nil {
+			var limitErr *LimitError
+			if errors.As(err, &limitErr) {
+				// A limit belongs to the run rather than the module, a later run continues at the expression that was stopped.
+				return nil, err
+			}
+			instance.err = err
+			break
+		}
+		instance.evaluated++
+	}
+	return instance.Environment, instance.err
+}
+
+// evaluateImport evaluates the imported module and binds its definitions in the given environment.
+func evaluateImport(
+	data ImportData,
+	env *Environment,
+) (
+	Value,
+	error,
+) {
+	moduleEnv, err := data.Module.evaluate(env.interpreter)
+	if err != nil {
+		return Value{}, err
+	}
+	for _, name := range data.Names {
+		value, ok := moduleEnv.Values[name]
+		if !ok {
+			continue
+		}
+		if data.Prefix != "" {
+			name = data.Prefix + "-" + name
+		}
+		env.Set(name, value)
+	}
+	return Value{
+		Type: Option,
+		Data: OptionValue{
+			Some: false,
+		},
+	}, nil
+}
@@ -0,0 +1,211 @@
+package language
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mapResolver returns an import resolver that reads files from the given map.
+func mapResolver(
+	files map[string]string,
+) ImportResolver {
+	return func(
+		importPath string,
+		baseFile string,
+	) (
+		string,
+		[]byte,
+		error,
+	) {
+		content, ok := files[importPath]
+		if !ok {
+			return "", nil, errors.New("file not found")
+		}
+		return importPath, []byte(content), nil
+	}
+}
+
+func TestImportEnvironments(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"shared": `
+			[define offset 10]
+			[define shift
+				[function [n]
+					[int-add n offset]
+				]
+			]
+		`,
+		"uses-global": `
+			[define leak
+				[function []
+					secret
+				]
+			]
+		`,
+	}
+	cache := NewModuleCache()
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	first, err := ParseWithCache("[import 'shared']", "<test>", mapResolver(files), cache)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	second, err := ParseWithCache("[import 'shared']", "<other>", mapResolver(files), cache)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if first.Data.(ImportData).Module != second.Data.(ImportData).Module {
+		t.Errorf("expected a module imported twice to be shared")
+	}
+
+	// A local definition of the same name is not used by the imported function.
+	if _, err := EvaluateUntilConcrete(first, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	_ = evaluateOrFail("[define offset 1000]", env, t)
+	result := evaluateOrFail("[shift 5]", env, t)
+	if valueToString(result) != "int<15>" {
+		t.Errorf("expected int<15>, got %s", valueToString(result))
+	}
+
+	// Modules do not see the definitions of the file importing them.
+	_ = evaluateOrFail("[define secret 42]", env, t)
+	expression, err := ParseWithCache("[import 'uses-global']", "<test>", mapResolver(files), cache)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, err := EvaluateUntilConcrete(expression, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	expression, err = Parse("[leak]", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, err := EvaluateUntilConcrete(expression, env); err == nil {
+		t.Errorf("expected the module to not see the importing environment")
+	}
+}
+
+func TestSelectiveImports(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"gfx": `
+			[define line 1]
+			[define circle 2]
+		`,
+	}
+
+	tests := []struct {
+		input   string
+		bound   []string
+		unbound []string
+	}{
+		{"[import 'gfx']", []string{"line", "circle"}, nil},
+		{"[import 'gfx' [line]]", []string{"line"}, []string{"circle"}},
+		{"[import 'gfx' as gfx]", []string{"gfx-line", "gfx-circle"}, []string{"line", "circle"}},
+		{"[import 'gfx' [circle] as gfx]", []string{"gfx-circle"}, []string{"gfx-line", "circle"}},
+	}
+
+	for _, test := range tests {
+		env := NewEnv(nil)
+		AddBuiltins(env)
+		expression, err := Parse(test.input, "<test>", mapResolver(files))
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", test.input, err)
+		}
+		if _, err := EvaluateUntilConcrete(expression, env); err != nil {
+			t.Fatalf("Eval error in input %q: %v", test.input, err)
+		}
+		for _, name := range test.bound {
+			if _, ok := env.Values[name]; !ok {
+				t.Errorf("For %s: expected %s to be bound", test.input, name)
+			}
+		}
+		for _, name := range test.unbound {
+			if _, ok := env.Values[name]; ok {
+				t.Errorf("For %s: expected %s to not be bound", test.input, name)
+			}
+		}
+	}
+
+	_, err := Parse("[import 'gfx'\n  [line square]]", "<test>", mapResolver(files))
+	if err == nil || err.Error() != "<test>:2:9 square is not defined in imported file gfx" {
+		t.Errorf("expected an error for an unknown name, got %v", err)
+	}
+}
+
+func TestImportResolution(
+	t *testing.T,
+) {
+	root := t.TempDir()
+	library := t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "main"):              "[import 'game/player']",
+		filepath.Join(root, "game", "player"):    "[import 'speed'] [define player speed]",
+		filepath.Join(root, "game", "speed"):     "[import 'base'] [define speed base]",
+		filepath.Join(library, "base"):           "[define base 3]",
+		filepath.Join(root, "cycle", "first"):    "[import 'second']",
+		filepath.Join(root, "cycle", "second"):   "[define value 1]\n[import 'first']",
+		filepath.Join(root, "cycle", "entrance"): "[import 'first']",
+		filepath.Join(root, "cycle", "parent"):   "[import 'child']",
+		filepath.Join(root, "cycle", "child"):    "[import 'parent']",
+		filepath.Join(root, "cycle", "self"):     "[import 'self']",
+	}
+	for fileName, content := range files {
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolver := NewFileImportResolver(library)
+
+	mainFile := filepath.Join(root, "main")
+	expression, err := Parse(files[mainFile], mainFile, resolver)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	if _, err := EvaluateUntilConcrete(expression, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	result := evaluateOrFail("player", env, t)
+	if valueToString(result) != "int<3>" {
+		t.Errorf("expected int<3>, got %s", valueToString(result))
+	}
+
+	entrance := filepath.Join(root, "cycle", "entrance")
+	_, err = Parse(files[entrance], entrance, resolver)
+	expected := "import cycle detected:\n" +
+		"  " + filepath.Join(root, "cycle", "first") + ":1:2 imports " + filepath.Join(root, "cycle", "second") + "\n" +
+		"  " + filepath.Join(root, "cycle", "second") + ":2:2 imports " + filepath.Join(root, "cycle", "first")
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected an import cycle error, got %v", err)
+	}
+
+	parent := filepath.Join(root, "cycle", "parent")
+	child := filepath.Join(root, "cycle", "child")
+	_, err = Parse(files[parent], parent, resolver)
+	expected = "import cycle detected:\n" +
+		"  " + parent + ":1:2 imports " + child + "\n" +
+		"  " + child + ":1:2 imports " + parent
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected an import cycle back to the parsed file, got %v", err)
+	}
+
+	self := filepath.Join(root, "cycle", "self")
+	_, err = Parse(files[self], self, resolver)
+	expected = "import cycle detected:\n" +
+		"  " + self + ":1:2 imports " + self
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected a file importing itself to be a cycle, got %v", err)
+	}
+}
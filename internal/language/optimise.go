@@ -0,0 +1,451 @@
+package language
+
+// Optimise returns a smaller expression that evaluates to the same result. It folds int-add and int-subtract over literal integers, removes the branch of an if that can not be taken, inlines calls to functions that return a constant or one of their parameters once they are defined, and removes definitions in imported modules that are not used. Calls to procedures are never removed. Builtins are resolved in the environment the expression will be evaluated in, and are left alone if the program defines a name of its own for them. The parsed expression and its modules are left unchanged.
+func Optimise(
+	expression Value,
+	env *Environment,
+) Value {
+	o := &optimiser{
+		env:      env,
+		bound:    make(map[string]int),
+		imported: make(map[*ModuleData]map[string]bool),
+		modules:  make(map[*ModuleData]*ModuleData),
+	}
+	o.collect(expression, make(map[*ModuleData]bool))
+
+	// A program is a single expression, so no definition in it is evaluated before the calls in it.
+	return o.optimise(expression, make(map[string]trivialFunction))
+}
+
+// optimiser holds what is known about the whole program while optimising it.
+type optimiser struct {
+	env *Environment
+	// bound counts how often each name is bound by a definition, parameter or pattern.
+	bound map[string]int
+	// imported holds the names that are imported from each module.
+	imported map[*ModuleData]map[string]bool
+	// modules maps each module to its optimised copy.
+	modules map[*ModuleData]*ModuleData
+}
+
+// collect records the names bound in the expression and the names imported from modules, including those in imported modules.
+func (
+	o *optimiser,
+) collect(
+	expression Value,
+	visited map[*ModuleData]bool,
+) {
+	switch expression.Type {
+	case Import:
+		data := expression.Data.(ImportData)
+		if o.imported[data.Module] == nil {
+			o.imported[data.Module] = make(map[string]bool)
+		}
+		for _, name := range data.Names {
+			o.imported[data.Module][name] = true
+			if data.Prefix != "" {
+				name = data.Prefix + "-" + name
+			}
+			o.bound[name]++
+		}
+		if !visited[data.Module] {
+			visited[data.Module] = true
+			for _, moduleExpression := range data.Module.Expressions {
+				o.collect(moduleExpression, visited)
+			}
+		}
+
+	case List:
+		list := expression.Data.([]Value)
+		if len(list) == 0 {
+			return
+		}
+		if list[0].Type == Symbol {
+			switch list[0].Data.(string) {
+			case "define":
+				if len(list) == 3 && list[1].Type == Symbol {
+					o.bound[list[1].Data.(string)]++
+				}
+			case "function", "procedure":
+				if _, rest, err := parseReturnType(list[0].Data.(string), list[1:]); err == nil {
+					if parameters, _, err := parseParameters(list[0].Data.(string), rest[0]); err == nil {
+						for _, parameter := range parameters {
+							o.bound[parameter.Name]++
+						}
+					}
+				}
+			case "match":
+				for _, clause := range list[2:] {
+					if clause.Type == List && len(clause.Data.([]Value)) == 2 {
+						o.collectPattern(clause.Data.([]Value)[0], false)
+					}
+				}
+			}
+		}
+		for _, elem := range list {
+			o.collect(elem, visited)
+		}
+	}
+}
+
+// collectPattern records the symbols a match pattern binds. As the checker does not know which names are structs it treats every symbol inside a list pattern as bound, which is only ever more careful.
+func (
+	o *optimiser,
+) collectPattern(
+	pattern Value,
+	nested bool,
+) {
+	switch pattern.Type {
+	case Symbol:
+		if nested {
+			o.bound[pattern.Data.(string)]++
+		}
+	case List:
+		patternList := pattern.Data.([]Value)
+		if len(patternList) > 0 && patternList[0].Type == Symbol {
+			patternList = patternList[1:]
+		}
+		for _, subpattern := range patternList {
+			o.collectPattern(subpattern, true)
+		}
+	}
+}
+
+// isBuiltin reports whether the name refers to the builtin of the environment in the whole program.
+func (
+	o *optimiser,
+) isBuiltin(
+	name string,
+) bool {
+	if o.bound[name] > 0 || o.env == nil {
+		return false
+	}
+	value, err := o.env.Get(name)
+	if err != nil {
+		return false
+	}
+	_, ok := value.Data.(func([]Value, *Environment) (Value, error))
+	return ok
+}
+
+// trivialFunction is a function whose calls can be replaced. Its body is either a constant, or the argument at Parameter when Parameter is not negative.
+type trivialFunction struct {
+	Arity     int
+	Parameter int
+	Body      Value
+}
+
+// trivialDefinition reports whether an expression is a top level definition of a function that only returns a constant or one of its parameters. Only names that are bound once in the whole program and not yet defined in the environment are considered, and only functions without types or guards, as those would evaluate their arguments.
+func (
+	o *optimiser,
+) trivialDefinition(
+	expression Value,
+) (
+	string,
+	trivialFunction,
+	bool,
+) {
+	if !isForm(expression, "define") {
+		return "", trivialFunction{}, false
+	}
+	list := expression.Data.([]Value)
+	if len(list) != 3 || list[1].Type != Symbol || !isForm(list[2], "function") {
+		return "", trivialFunction{}, false
+	}
+	name := list[1].Data.(string)
+	function := list[2].Data.([]Value)
+	if o.bound[name] != 1 || !o.isBuiltin("define") || !o.isBuiltin("function") || len(function) != 3 {
+		return "", trivialFunction{}, false
+	}
+	if _, err := o.env.Get(name); err == nil {
+		// It would be overloaded with the existing definition.
+		return "", trivialFunction{}, false
+	}
+	parameters, guard, err := parseParameters("function", function[1])
+	if err != nil || guard.Type != Unknown {
+		return "", trivialFunction{}, false
+	}
+	for _, parameter := range parameters {
+		if parameter.Type != Unknown {
+			return "", trivialFunction{}, false
+		}
+	}
+
+	body := function[2]
+	switch body.Type {
+	case Bool, Fixed, Float, Int, String:
+		return name, trivialFunction{
+			Arity:     len(parameters),
+			Parameter: -1,
+			Body:      body,
+		}, true
+	case Symbol:
+		for index, parameter := range parameters {
+			if parameter.Name == body.Data.(string) {
+				return name, trivialFunction{
+					Arity:     len(parameters),
+					Parameter: index,
+				}, true
+			}
+		}
+	}
+	return "", trivialFunction{}, false
+}
+
+// optimise optimises an expression, its arguments are optimised before the expression itself.
+func (
+	o *optimiser,
+) optimise(
+	expression Value,
+	trivial map[string]trivialFunction,
+) Value {
+	if expression.Type == Import {
+		data := expression.Data.(ImportData)
+		data.Module = o.optimiseModule(data.Module)
+		expression.Data = data
+		return expression
+	}
+	if expression.Type != List || expression.PreventEval {
+		return expression
+	}
+
+	list := expression.Data.([]Value)
+	optimised := append([]Value{}, list...)
+	for _, i := range o.evaluatedElements(list) {
+		optimised[i] = o.optimise(list[i], trivial)
+	}
+	if isForm(expression, "match") && o.isBuiltin("match") {
+		for i := 2; i < len(optimised); i++ {
+			clause, ok := optimised[i].Data.([]Value)
+			if optimised[i].Type != List || !ok || len(clause) != 2 {
+				continue
+			}
+			optimised[i].Data = []Value{clause[0], o.optimise(clause[1], trivial)}
+		}
+	}
+	expression.Data = optimised
+	if len(optimised) == 0 || optimised[0].Type != Symbol {
+		return expression
+	}
+
+	name := optimised[0].Data.(string)
+	args := optimised[1:]
+	if function, ok := trivial[name]; ok && len(args) == function.Arity {
+		if function.Parameter >= 0 {
+			return args[function.Parameter]
+		}
+		body := function.Body
+		body.Position = expression.Position
+		return body
+	}
+	if !o.isBuiltin(name) {
+		return expression
+	}
+
+	switch name {
+	case "int-add", "int-subtract":
+		numbers := make([]int64, len(args))
+		for i, arg := range args {
+			if arg.Type != Int {
+				return expression
+			}
+			numbers[i] = arg.Data.(int64)
+		}
+		var result int64
+		for i, number := range numbers {
+			if name == "int-add" || i == 0 {
+				result += number
+			} else {
+				result -= number
+			}
+		}
+		return Value{
+			Type:     Int,
+			Data:     result,
+			Position: expression.Position,
+		}
+
+	case "if":
+		if len(args) != 2 && len(args) != 3 {
+			return expression
+		}
+		condition := args[0]
+		if condition.Type == Symbol && condition.Data.(string) == "none" && o.bound["none"] == 0 {
+			if value, err := o.env.Get("none"); err == nil {
+				condition = value
+			}
+		}
+		switch condition.Type {
+		case Bool, Fixed, Float, Int, Option, String:
+		default:
+			return expression
+		}
+		if isTruthy(condition) {
+			return args[1]
+		}
+		if len(args) == 3 {
+			return args[2]
+		}
+		return Value{
+			Type: Option,
+			Data: OptionValue{
+				Some: false,
+			},
+			Position: expression.Position,
+		}
+	}
+	return expression
+}
+
+// evaluatedElements returns the indexes of the elements of a list that are evaluated as expressions. Parameter lists and struct fields are not, and are left as they are. Of a match only the value is returned, the results of its clauses are optimised separately from their patterns.
+func (
+	o *optimiser,
+) evaluatedElements(
+	list []Value,
+) []int {
+	if len(list) > 0 && list[0].Type == Symbol && o.isBuiltin(list[0].Data.(string)) {
+		switch list[0].Data.(string) {
+		case "function", "procedure":
+			return []int{len(list) - 1}
+		case "struct":
+			return nil
+		case "match":
+			if len(list) < 2 {
+				return nil
+			}
+			for _, clause := range list[2:] {
+				if clause.Type != List || len(clause.Data.([]Value)) != 2 {
+					return nil
+				}
+			}
+			return []int{1}
+		}
+	}
+	indexes := make([]int, len(list))
+	for i := range list {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// optimisedModule is the optimised copy of a module. Every expression of the module is optimised, but only the expressions that are kept are in the copy.
+type optimisedModule struct {
+	Module      *ModuleData
+	Expressions []Value
+	Kept        []bool
+	// Used holds the names that are imported from the module or referred to by the kept expressions.
+	Used map[string]bool
+}
+
+// optimiseModule returns the optimised copy of a module. Top level definitions that are not imported and not used within the module are removed, as long as evaluating them has no side effects. The copy is kept in the cache of the module, so a module is optimised and evaluated once however many programs are optimised. Definitions a later program imports are added back to the copy.
+func (
+	o *optimiser,
+) optimiseModule(
+	module *ModuleData,
+) *ModuleData {
+	if optimised, ok := o.modules[module]; ok {
+		return optimised
+	}
+	shared := module.cache.getOptimised(module)
+	if shared == nil {
+		shared = &optimisedModule{
+			Module: &ModuleData{
+				FileName:      module.FileName,
+				Definitions:   module.Definitions,
+				Documentation: module.Documentation,
+				Environment:   NewEnv(module.Environment.Outer),
+				cache:         module.cache,
+			},
+			Kept: make([]bool, len(module.Expressions)),
+			Used: make(map[string]bool),
+		}
+		o.modules[module] = shared.Module
+		trivial := make(map[string]trivialFunction)
+		shared.Expressions = make([]Value, len(module.Expressions))
+		for i, expression := range module.Expressions {
+			shared.Expressions[i] = o.optimise(expression, trivial)
+			// Calls are only inlined where the definition has already been evaluated, in the expressions after it.
+			if name, function, ok := o.trivialDefinition(expression); ok {
+				trivial[name] = function
+			}
+		}
+		shared = module.cache.addOptimised(module, shared)
+	}
+	o.modules[module] = shared.Module
+	shared.keep(o.imported[module])
+	return shared.Module
+}
+
+// keep adds the expressions that are needed for the imported names to the optimised module. Every expression that is not a removable definition is kept, as are the definitions they refer to, until nothing changes. Expressions that are added together keep their order in the module.
+func (
+	m *optimisedModule,
+) keep(
+	imported map[string]bool,
+) {
+	m.Module.mu.Lock()
+	defer m.Module.mu.Unlock()
+	for name := range imported {
+		m.Used[name] = true
+	}
+	added := make([]bool, len(m.Expressions))
+	for changed := true; changed; {
+		changed = false
+		for i, expression := range m.Expressions {
+			if m.Kept[i] {
+				continue
+			}
+			name, removable := removableDefinition(expression)
+			if removable && !m.Used[name] {
+				continue
+			}
+			m.Kept[i] = true
+			added[i] = true
+			changed = true
+			collectSymbols(expression, m.Used)
+		}
+	}
+	for i, expression := range m.Expressions {
+		if added[i] {
+			m.Module.Expressions = append(m.Module.Expressions, expression)
+		}
+	}
+}
+
+// removableDefinition reports whether an expression is a definition that can be removed without changing the program, because evaluating it has no side effects. It returns the defined name.
+func removableDefinition(
+	expression Value,
+) (
+	string,
+	bool,
+) {
+	if !isForm(expression, "define") {
+		return "", false
+	}
+	list := expression.Data.([]Value)
+	if len(list) != 3 || list[1].Type != Symbol {
+		return "", false
+	}
+	switch list[2].Type {
+	case Bool, Fixed, Float, Int, Option, String, Symbol:
+		return list[1].Data.(string), true
+	}
+	if isForm(list[2], "function") || isForm(list[2], "procedure") || isForm(list[2], "struct") {
+		return list[1].Data.(string), true
+	}
+	return "", false
+}
+
+// collectSymbols adds every symbol in the expression to the set.
+func collectSymbols(
+	expression Value,
+	symbols map[string]bool,
+) {
+	switch expression.Type {
+	case Symbol:
+		symbols[expression.Data.(string)] = true
+	case List:
+		for _, elem := range expression.Data.([]Value) {
+			collectSymbols(elem, symbols)
+		}
+	}
+}
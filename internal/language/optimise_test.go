@@ -0,0 +1,133 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestOptimise(
+	t *testing.T,
+) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[int-add 1 2 3]", "6"},
+		{"[int-subtract 10 [int-add 1 2]]", "7"},
+		{"[int-add x 1]", "[int-add x 1]"},
+		{"[if true 1 2]", "1"},
+		{"[if false 1 2]", "2"},
+		{"[if none 1 2]", "2"},
+		{"[if false 1]", "none<>"},
+		{"[if 0 'zero' 'other']", "'zero'"},
+		{"[if x 1 2]", "[if x 1 2]"},
+		{"[define f [procedure [] [int-add 1 2]]]", "[define f [procedure [] 3]]"},
+		{"[define f [function [int-add] [int-add 1 2]]]", "[define f [function [int-add] [int-add 1 2]]]"},
+		{"[define f [function [int n when [if true n]] n]]", "[define f [function [int n when [if true n]] n]]"},
+		{"[match x [[some y] [int-add 1 1]] [none 0]]", "[match x [[some y] 2] [none 0]]"},
+		{"[struct [int x]]", "[struct [int x]]"},
+		{"[if true [f 1] [define f [function [x] 2]]]", "[f 1]"},
+	}
+
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	for _, test := range tests {
+		expression, err := Parse(test.input, "<test>", nil)
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", test.input, err)
+		}
+		result := expressionToString(Optimise(expression, env))
+		if result != test.expected {
+			t.Errorf("Optimise(%q) = %s, expected %s", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestOptimiseModules(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"shapes": `
+			[define unit 1]
+			[define unused 2]
+			[define one [function [] unit]]
+			[define first [function [a b] a]]
+			[define typed [function [int a] a]]
+			[define side-effect [int-parse '12']]
+			[define loop [procedure [] [loop]]]
+			[define area
+				[function [n]
+					[first
+						[int-add n [one] [typed 1] [if true 0 [loop]]]
+						[loop]
+					]
+				]
+			]
+		`,
+	}
+	expected := []string{
+		"[define unit 1]",
+		"[define one [function [] unit]]",
+		"[define typed [function [int a] a]]",
+		"[define side-effect [int-parse '12']]",
+		"[define area [function [n] [int-add n [one] [typed 1] 0]]]",
+	}
+
+	cache := NewModuleCache()
+	expression, err := ParseWithCache("[import 'shapes' [area]]", "<test>", mapResolver(files), cache)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	optimised := Optimise(expression, env)
+	var definitions []string
+	for _, definition := range optimised.Data.(ImportData).Module.Expressions {
+		definitions = append(definitions, expressionToString(definition))
+	}
+	if len(definitions) != len(expected) {
+		t.Fatalf("optimised module = %v, expected %v", definitions, expected)
+	}
+	for i := range expected {
+		if definitions[i] != expected[i] {
+			t.Errorf("optimised module = %v, expected %v", definitions, expected)
+		}
+	}
+	if len(expression.Data.(ImportData).Module.Expressions) != 8 {
+		t.Errorf("Optimise changed the parsed module")
+	}
+
+	if _, err := Evaluate(expression, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	before := evaluateOrFail("[area 3]", env, t)
+	env = NewEnv(nil)
+	AddBuiltins(env)
+	if _, err := Evaluate(optimised, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	after := evaluateOrFail("[area 3]", env, t)
+	if valueToString(before) != valueToString(after) {
+		t.Errorf("optimised [area 3] = %s, expected %s", valueToString(after), valueToString(before))
+	}
+
+	// A program optimised later shares the evaluated module, and gets back the definitions it needs.
+	expression, err = ParseWithCache("[import 'shapes' [unused area]]", "<test>", mapResolver(files), cache)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	later := Optimise(expression, env)
+	module := later.Data.(ImportData).Module
+	if module != optimised.Data.(ImportData).Module {
+		t.Errorf("optimising the import again created another module")
+	}
+	if _, err := Evaluate(later, env); err != nil {
+		t.Fatalf("Eval error: %v", err)
+	}
+	if unused := evaluateOrFail("unused", env, t); valueToString(unused) != "int<2>" {
+		t.Errorf("unused = %s, expected int<2>", valueToString(unused))
+	}
+	if module.instances[env.interpreter].evaluated != len(expected)+1 {
+		t.Errorf("evaluated %d expressions of the module, expected %d", module.instances[env.interpreter].evaluated, len(expected)+1)
+	}
+}
@@ -0,0 +1,189 @@
+package language
+
+import (
+	"errors"
+	"strings"
+)
+
+// overload combines an existing definition with a new function of the same name into an overload set. It reports false if the values can not be overloaded, in which case the new value replaces the existing one.
+func overload(
+	name string,
+	existing Value,
+	value Value,
+) (
+	Value,
+	bool,
+) {
+	if existing.Type != value.Type || (value.Type != Function && value.Type != Procedure) {
+		return Value{}, false
+	}
+	function, ok := value.Data.(FunctionData)
+	if !ok {
+		return Value{}, false
+	}
+
+	var candidates []FunctionData
+	switch existingData := existing.Data.(type) {
+	case FunctionData:
+		candidates = []FunctionData{existingData}
+	case OverloadData:
+		candidates = existingData.Candidates
+	default:
+		return Value{}, false
+	}
+
+	// A function with the same parameters replaces the earlier definition.
+	overloads := OverloadData{
+		Name: name,
+	}
+	for _, candidate := range candidates {
+		if !sameSignature(candidate, function) {
+			overloads.Candidates = append(overloads.Candidates, candidate)
+		}
+	}
+	if len(overloads.Candidates) == 0 {
+		return Value{}, false
+	}
+	overloads.Candidates = append(overloads.Candidates, function)
+
+	return Value{
+		Type: value.Type,
+		Data: overloads,
+	}, true
+}
+
+// sameSignature reports whether two functions accept the same arguments.
+func sameSignature(
+	a FunctionData,
+	b FunctionData,
+) bool {
+	if len(a.Parameters) != len(b.Parameters) {
+		return false
+	}
+	for i := range a.Parameters {
+		if a.Parameters[i].Type != b.Parameters[i].Type {
+			return false
+		}
+	}
+	if a.Guard.Type != b.Guard.Type {
+		return false
+	}
+	return a.Guard.Type == Unknown || expressionToString(a.Guard) == expressionToString(b.Guard)
+}
+
+// call picks the candidate that matches the arguments and calls it. Arguments are only evaluated if a candidate of the same arity declares a type for them. Candidates with more typed parameters are tried first. Within the same number of typed parameters the candidates with a guard are tried in the order they are defined, and if none of their guards pass the candidate without a guard is called. If several candidates without a guard match equally well the call is ambiguous.
+func (
+	o OverloadData,
+) call(
+	args []Value,
+	env *Environment,
+) (
+	Value,
+	error,
+) {
+	args = append([]Value{}, args...)
+	evaluated := make([]bool, len(args))
+	for _, candidate := range o.Candidates {
+		if len(candidate.Parameters) != len(args) {
+			continue
+		}
+		for i, parameter := range candidate.Parameters {
+			if parameter.Type == Unknown || evaluated[i] {
+				continue
+			}
+			arg, err := EvaluateUntilConcrete(args[i], env)
+			if err != nil {
+				return Value{}, err
+			}
+			args[i] = arg
+			evaluated[i] = true
+		}
+	}
+
+	// Group the matching candidates by the number of typed parameters.
+	matches := make(map[int][]FunctionData)
+	bestScore := -1
+	for _, candidate := range o.Candidates {
+		if len(candidate.Parameters) != len(args) {
+			continue
+		}
+		score := 0
+		for i, parameter := range candidate.Parameters {
+			if parameter.Type == Unknown {
+				continue
+			}
+			if parameter.Type != args[i].Type {
+				score = -1
+				break
+			}
+			score++
+		}
+		if score < 0 {
+			continue
+		}
+		matches[score] = append(matches[score], candidate)
+		if score > bestScore {
+			bestScore = score
+		}
+	}
+
+	var tried []FunctionData
+	for score := bestScore; score >= 0; score-- {
+		var unguarded []FunctionData
+		for _, candidate := range matches[score] {
+			if candidate.Guard.Type == Unknown {
+				unguarded = append(unguarded, candidate)
+				continue
+			}
+			result, err := candidate.Call(args, env)
+			var guardErr *guardError
+			if errors.As(err, &guardErr) {
+				tried = append(tried, candidate)
+				continue
+			}
+			return result, err
+		}
+
+		if len(unguarded) == 1 {
+			return unguarded[0].Call(args, env)
+		}
+		if len(unguarded) > 1 {
+			return Value{}, errors.New("ambiguous call to '" + o.Name + "' with " + argumentTypesToString(args, evaluated) + "; candidates: " + candidatesToString(unguarded))
+		}
+	}
+
+	if len(tried) > 0 {
+		return Value{}, errors.New("no overload of '" + o.Name + "' accepts " + argumentTypesToString(args, evaluated) + ", the guards of these candidates did not pass: " + candidatesToString(tried))
+	}
+	return Value{}, errors.New("no overload of '" + o.Name + "' accepts " + argumentTypesToString(args, evaluated) + "; candidates: " + candidatesToString(o.Candidates))
+}
+
+// argumentTypesToString describes the arguments of a call. Arguments that have not been evaluated are described as any.
+func argumentTypesToString(
+	args []Value,
+	evaluated []bool,
+) string {
+	if len(args) == 0 {
+		return "no arguments"
+	}
+	var types []string
+	for i, arg := range args {
+		if evaluated[i] {
+			types = append(types, typeToString(arg.Type))
+		} else {
+			types = append(types, "any")
+		}
+	}
+	return "(" + strings.Join(types, " ") + ")"
+}
+
+// candidatesToString lists the signatures of the candidates of an overload set.
+func candidatesToString(
+	candidates []FunctionData,
+) string {
+	var definitions []string
+	for _, candidate := range candidates {
+		definitions = append(definitions, candidate.Definition)
+	}
+	return strings.Join(definitions, ", ")
+}
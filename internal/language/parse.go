@@ -3,7 +3,9 @@ package language
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -14,42 +16,81 @@ type Token struct {
 
 	Row    int
 	Column int
+
+	// Documentation holds the doc comments written directly before the token, one line per comment.
+	Documentation []string
 }
 
+// ImportResolver resolves the path of an import statement from the file containing it. It returns the resolved file name, which identifies the module, and the contents of the file.
 type ImportResolver func(
 	importPath string,
 	baseFile string,
 ) (
+	string,
 	[]byte,
 	error,
 )
 
-func defaultImportResolver(
-	importPath string,
-	baseFile string,
-) (
-	[]byte,
-	error,
-) {
-	return os.ReadFile(importPath)
+var defaultImportResolver = NewFileImportResolver()
+
+// NewFileImportResolver creates a resolver that reads imports from the file system. A relative import is first looked up relative to the directory of the importing file, then in each of the search paths in order.
+func NewFileImportResolver(
+	searchPaths ...string,
+) ImportResolver {
+	return func(
+		importPath string,
+		baseFile string,
+	) (
+		string,
+		[]byte,
+		error,
+	) {
+		candidates := []string{importPath}
+		if !filepath.IsAbs(importPath) {
+			candidates = []string{filepath.Join(filepath.Dir(baseFile), importPath)}
+			for _, searchPath := range searchPaths {
+				candidates = append(candidates, filepath.Join(searchPath, importPath))
+			}
+		}
+
+		for _, candidate := range candidates {
+			data, err := os.ReadFile(candidate)
+			if err == nil {
+				return candidate, data, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", nil, err
+			}
+		}
+		return "", nil, errors.New("file not found in " + strings.Join(candidates, ", "))
+	}
 }
 
 var validSymbol = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 var validInt = regexp.MustCompile(`^-?[0-9]+$`)
 var validFloat = regexp.MustCompile(`^-?[0-9]*\.[0-9]+([eE]-?[0-9]+)?$`)
+var validFixed = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?x$`)
 
+// tokenize splits the input into tokens. A comment starts with a single slash and runs until the end of the line. A doc comment starts with two slashes and is attached to the token that follows it.
 func tokenize(
 	input string,
 ) []Token {
 	var tokens []Token
 	var currentToken strings.Builder
 	var tokenStartRow, tokenStartColumn int
+	var documentation []string
 	inString := false
 	row, column := 1, 1
 
+	addToken := func(token Token) {
+		token.Documentation = documentation
+		documentation = nil
+		tokens = append(tokens, token)
+	}
+
 	flushToken := func() {
 		if currentToken.Len() > 0 {
-			tokens = append(tokens, Token{
+			addToken(Token{
 				Content: currentToken.String(),
 
 				Row:    tokenStartRow,
@@ -75,7 +116,7 @@ func tokenize(
 			} else if c == CHR_STRING {
 				inString = false
 				currentToken.WriteByte(c)
-				tokens = append(tokens, Token{
+				addToken(Token{
 					Content: STR_STRING + currentToken.String()[1:len(currentToken.String())-1] + STR_STRING,
 					Row:     tokenStartRow,
 					Column:  tokenStartColumn,
@@ -93,11 +134,22 @@ func tokenize(
 				currentToken.WriteByte(c)
 			} else if c == CHR_LIST_START || c == CHR_LIST_END {
 				flushToken()
-				tokens = append(tokens, Token{
+				addToken(Token{
 					Content: string(c),
 					Row:     row,
 					Column:  column,
 				})
+			} else if c == CHR_COMMENT {
+				flushToken()
+				start := i
+				for i+1 < len(input) && input[i+1] != '\n' && input[i+1] != '\r' {
+					i++
+					column++
+				}
+				comment := input[start : i+1]
+				if strings.HasPrefix(comment, STR_COMMENT+STR_COMMENT) {
+					documentation = append(documentation, strings.TrimSpace(comment[2:]))
+				}
 			} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
 				flushToken()
 			} else {
@@ -106,7 +158,8 @@ func tokenize(
 		}
 
 		if c == '\n' || c == '\r' {
-			if i+1 < len(input) && (input[i+1] == '\n' || input[i+1] == '\r') {
+			// A carriage return followed by a newline is a single line break.
+			if c == '\r' && i+1 < len(input) && input[i+1] == '\n' {
 				i++
 			}
 			row++
@@ -119,10 +172,32 @@ func tokenize(
 	return tokens
 }
 
+// ParseDocumentation returns the doc comments of the definitions in the input, keyed by the defined name. The doc comments of a definition are those written directly before its opening bracket.
+func ParseDocumentation(
+	input string,
+) map[string]string {
+	return tokenDocumentation(tokenize(input))
+}
+
+// tokenDocumentation returns the doc comments of every `[define name ...]` in the tokens.
+func tokenDocumentation(
+	tokens []Token,
+) map[string]string {
+	documentation := make(map[string]string)
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].Content != STR_LIST_START || tokens[i+1].Content != "define" || len(tokens[i].Documentation) == 0 {
+			continue
+		}
+		documentation[tokens[i+2].Content] = strings.Join(tokens[i].Documentation, "\n")
+	}
+	return documentation
+}
+
 func parseTokens(
 	tokens []Token,
 	fileName string,
 	resolver ImportResolver,
+	cache *ModuleCache,
 ) (
 	Value,
 	[]Token,
@@ -137,32 +212,17 @@ func parseTokens(
 	if token.Content == STR_LIST_START {
 		// Check for import statements.
 		if len(tokens) >= 2 && tokens[0].Content == "import" {
-			importToken := tokens[0]
-			fileToken := tokens[1]
-			tokens = tokens[2:]
-			if len(tokens) == 0 || tokens[0].Content != STR_LIST_END {
-				errMsg := fmt.Sprintf("%s:%d:%d missing %s after import statement", fileName, importToken.Row, importToken.Column, STR_LIST_END)
-				return Value{}, tokens, errors.New(errMsg)
-			}
-
-			tokens = tokens[1:]
-			importPath := fileToken.Content
-			if resolver == nil {
-				resolver = defaultImportResolver
-			}
-			data, err := resolver(importPath, fileName)
-
-			if err != nil {
-				errMsg := fmt.Sprintf("%s:%d:%d failed to import file %s: %v", fileName, importToken.Row, importToken.Column, importPath, err)
-				return Value{}, tokens, errors.New(errMsg)
-			}
-			importValue, err := Parse(string(data), importPath, resolver)
-
+			value, tokens, err := parseImport(
+				tokens,
+				fileName,
+				resolver,
+				cache,
+			)
 			if err != nil {
-				errMsg := fmt.Sprintf("%s:%d:%d error in imported file %s: %v", fileName, importToken.Row, importToken.Column, importPath, err)
-				return Value{}, tokens, errors.New(errMsg)
+				return Value{}, tokens, err
 			}
-			return importValue, tokens, nil
+			value.Position = tokenPosition(token, fileName)
+			return value, tokens, nil
 		}
 
 		var listValue []Value
@@ -173,6 +233,7 @@ func parseTokens(
 				tokens,
 				fileName,
 				resolver,
+				cache,
 			)
 			if err != nil {
 				return Value{}, tokens, err
@@ -188,8 +249,9 @@ func parseTokens(
 		tokens = tokens[1:]
 
 		return Value{
-			Type: List,
-			Data: listValue,
+			Type:     List,
+			Data:     listValue,
+			Position: tokenPosition(token, fileName),
 		}, tokens, nil
 	} else if token.Content == STR_LIST_END {
 		errMsg := fmt.Sprintf("%s:%d:%d unexpected %s", fileName, token.Row, token.Column, token.Content)
@@ -200,10 +262,135 @@ func parseTokens(
 	if err != nil {
 		return Value{}, tokens, err
 	}
+	value.Position = tokenPosition(token, fileName)
 
 	return value, tokens, nil
 }
 
+// tokenPosition returns the position of the token in the file.
+func tokenPosition(
+	token Token,
+	fileName string,
+) *Position {
+	return &Position{
+		File:   fileName,
+		Row:    token.Row,
+		Column: token.Column,
+	}
+}
+
+// parseImport parses an import statement, the opening bracket has already been consumed. The statement is either `[import 'path']`, `[import 'path' [names...]]` or `[import 'path' as prefix]`.
+func parseImport(
+	tokens []Token,
+	fileName string,
+	resolver ImportResolver,
+	cache *ModuleCache,
+) (
+	Value,
+	[]Token,
+	error,
+) {
+	importToken := tokens[0]
+	fileToken := tokens[1]
+	tokens = tokens[2:]
+
+	var nameTokens []Token
+	selective := false
+	if len(tokens) > 0 && tokens[0].Content == STR_LIST_START {
+		selective = true
+		tokens = tokens[1:]
+		for len(tokens) > 0 && tokens[0].Content != STR_LIST_END {
+			if !validSymbol.MatchString(tokens[0].Content) {
+				errMsg := fmt.Sprintf("%s:%d:%d imported name must be a symbol: %s", fileName, tokens[0].Row, tokens[0].Column, tokens[0].Content)
+				return Value{}, tokens, errors.New(errMsg)
+			}
+			nameTokens = append(nameTokens, tokens[0])
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			errMsg := fmt.Sprintf("%s:%d:%d missing %s after imported names", fileName, importToken.Row, importToken.Column, STR_LIST_END)
+			return Value{}, tokens, errors.New(errMsg)
+		}
+		tokens = tokens[1:]
+	}
+
+	prefix := ""
+	if len(tokens) > 0 && tokens[0].Content == "as" {
+		if len(tokens) < 2 || !validSymbol.MatchString(tokens[1].Content) {
+			errMsg := fmt.Sprintf("%s:%d:%d import prefix must be a symbol", fileName, tokens[0].Row, tokens[0].Column)
+			return Value{}, tokens, errors.New(errMsg)
+		}
+		prefix = tokens[1].Content
+		tokens = tokens[2:]
+	}
+
+	if len(tokens) == 0 || tokens[0].Content != STR_LIST_END {
+		errMsg := fmt.Sprintf("%s:%d:%d missing %s after import statement", fileName, importToken.Row, importToken.Column, STR_LIST_END)
+		return Value{}, tokens, errors.New(errMsg)
+	}
+	tokens = tokens[1:]
+
+	importPath := fileToken.Content
+	if len(importPath) >= 2 && importPath[0] == CHR_STRING && importPath[len(importPath)-1] == CHR_STRING {
+		importPath = importPath[1 : len(importPath)-1]
+	}
+
+	if resolver == nil {
+		resolver = defaultImportResolver
+	}
+	resolvedPath, data, err := resolver(importPath, fileName)
+	if err != nil {
+		errMsg := fmt.Sprintf("%s:%d:%d failed to import file %s: %v", fileName, importToken.Row, importToken.Column, importPath, err)
+		return Value{}, tokens, errors.New(errMsg)
+	}
+
+	hop := importHop{
+		FileName: fileName,
+		Row:      importToken.Row,
+		Column:   importToken.Column,
+		Imports:  resolvedPath,
+	}
+	if err := cache.checkCycle(hop); err != nil {
+		return Value{}, tokens, err
+	}
+
+	module, ok := cache.get(resolvedPath)
+	if !ok {
+		cache.loading = append(cache.loading, hop)
+		module, err = cache.add(string(data), resolvedPath, resolver)
+		cache.loading = cache.loading[:len(cache.loading)-1]
+		if err != nil {
+			var cycleErr *importCycleError
+			if errors.As(err, &cycleErr) {
+				return Value{}, tokens, err
+			}
+			errMsg := fmt.Sprintf("%s:%d:%d error in imported file %s: %v", fileName, importToken.Row, importToken.Column, resolvedPath, err)
+			return Value{}, tokens, errors.New(errMsg)
+		}
+	}
+
+	names := module.Definitions
+	if selective {
+		names = nil
+		for _, nameToken := range nameTokens {
+			if !module.defines(nameToken.Content) {
+				errMsg := fmt.Sprintf("%s:%d:%d %s is not defined in imported file %s", fileName, nameToken.Row, nameToken.Column, nameToken.Content, resolvedPath)
+				return Value{}, tokens, errors.New(errMsg)
+			}
+			names = append(names, nameToken.Content)
+		}
+	}
+
+	return Value{
+		Type: Import,
+		Data: ImportData{
+			Module: module,
+			Names:  names,
+			Prefix: prefix,
+		},
+	}, tokens, nil
+}
+
 func atom(
 	token Token,
 	fileName string,
@@ -241,6 +428,17 @@ func atom(
 		}
 	}
 
+	if validFixed.MatchString(token.Content) {
+		fixedValue, err := parseFixed(token.Content)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{
+			Type: Fixed,
+			Data: fixedValue,
+		}, nil
+	}
+
 	if validInt.MatchString(token.Content) {
 		if intValue, err := strconv.ParseInt(token.Content, 10, 64); err == nil {
 			return Value{
@@ -271,6 +469,7 @@ func joinTokenContents(
 	return strings.Join(parts, " ")
 }
 
+// Parse parses the input into a single expression. Imported files are parsed into modules that are only shared within this call, use ParseWithCache to share them between calls.
 func Parse(
 	input string,
 	fileName string,
@@ -278,13 +477,30 @@ func Parse(
 ) (
 	Value,
 	error,
+) {
+	return ParseWithCache(input, fileName, resolver, NewModuleCache())
+}
+
+// ParseWithCache parses the input into a single expression, re-using the modules in the cache for any imported files.
+func ParseWithCache(
+	input string,
+	fileName string,
+	resolver ImportResolver,
+	cache *ModuleCache,
+) (
+	Value,
+	error,
 ) {
 	tokens := tokenize(input)
+	// The file itself is the start of the chain, so an import back to it is a cycle.
+	cache.loading = append(cache.loading, importHop{Imports: fileName})
 	expression, remaining, err := parseTokens(
 		tokens,
 		fileName,
 		resolver,
+		cache,
 	)
+	cache.loading = cache.loading[:len(cache.loading)-1]
 	if err != nil {
 		return Value{}, err
 	}
@@ -0,0 +1,52 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestComments(
+	t *testing.T,
+) {
+	input := "[int-add 1 / the first number.\r\n  2 /no space needed\n\n  'a / b']"
+	tokens := tokenize(input)
+	expected := []Token{
+		{Content: "[", Row: 1, Column: 1},
+		{Content: "int-add", Row: 1, Column: 2},
+		{Content: "1", Row: 1, Column: 10},
+		{Content: "2", Row: 2, Column: 3},
+		{Content: "'a / b'", Row: 4, Column: 3},
+		{Content: "]", Row: 4, Column: 10},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %s", len(expected), len(tokens), joinTokenContents(tokens))
+	}
+	for i, token := range tokens {
+		if token.Content != expected[i].Content || token.Row != expected[i].Row || token.Column != expected[i].Column {
+			t.Errorf("token %d: expected %s at %d:%d, got %s at %d:%d", i, expected[i].Content, expected[i].Row, expected[i].Column, token.Content, token.Row, token.Column)
+		}
+	}
+}
+
+func TestDocumentation(
+	t *testing.T,
+) {
+	input := `
+		// Adds one to a number.
+		// Only accepts integers.
+		[define increment
+			[function [n]
+				[int-add n 1] / not a doc comment.
+			]
+		]
+
+		/ A regular comment.
+		[define two 2]
+	`
+	documentation := ParseDocumentation(input)
+	if len(documentation) != 1 {
+		t.Errorf("expected 1 documented definition, got %d", len(documentation))
+	}
+	if documentation["increment"] != "Adds one to a number.\nOnly accepts integers." {
+		t.Errorf("unexpected documentation for increment: %q", documentation["increment"])
+	}
+}
@@ -0,0 +1,181 @@
+package language
+
+import (
+	"errors"
+)
+
+// isDestructuringPattern reports whether a match pattern takes a value apart rather than comparing it. These are `none`, `[some pattern]`, `[ok pattern]`, `[error pattern]`, `[list pattern ...]`, `[cons head tail]` and `[struct-name pattern ...]`.
+func isDestructuringPattern(
+	pattern Value,
+	env *Environment,
+) bool {
+	if pattern.Type == Symbol {
+		return pattern.Data.(string) == "none"
+	}
+	if pattern.Type != List {
+		return false
+	}
+	patternList := pattern.Data.([]Value)
+	if len(patternList) == 0 || patternList[0].Type != Symbol {
+		return false
+	}
+	switch patternList[0].Data.(string) {
+	case "some", "ok", "error":
+		return len(patternList) == 2
+	case "cons":
+		return len(patternList) == 3
+	case "list":
+		return true
+	}
+	definition, err := env.Get(patternList[0].Data.(string))
+	return err == nil && definition.Type == StructDefinition
+}
+
+// matchPattern matches a value against a pattern and binds the symbols in the pattern in the bindings environment. At the top of a pattern a symbol is compared with the value it refers to, while inside a destructuring pattern a symbol is bound to the value in its place. An underscore matches anything without binding it.
+func matchPattern(
+	pattern Value,
+	value Value,
+	env *Environment,
+	bindings *Environment,
+	nested bool,
+) (
+	bool,
+	error,
+) {
+	if pattern.Type == Symbol {
+		name := pattern.Data.(string)
+		if name == "_" {
+			return true, nil
+		}
+		if name == "none" {
+			value, err := EvaluateUntilConcrete(value, env)
+			if err != nil {
+				return false, err
+			}
+			return value.Type == Option && !value.Data.(OptionValue).Some, nil
+		}
+		if nested {
+			bindings.Set(name, value)
+			return true, nil
+		}
+	}
+
+	value, err := EvaluateUntilConcrete(value, env)
+	if err != nil {
+		return false, err
+	}
+
+	if !isDestructuringPattern(pattern, env) {
+		patternValue, err := EvaluateUntilConcrete(pattern, env)
+		if err != nil {
+			return false, err
+		}
+		return valueEqual(value, patternValue, env), nil
+	}
+
+	patternList := pattern.Data.([]Value)
+	switch patternList[0].Data.(string) {
+	case "some":
+		if value.Type != Option || !value.Data.(OptionValue).Some {
+			return false, nil
+		}
+		return matchPattern(patternList[1], value.Data.(OptionValue).Value, env, bindings, true)
+
+	case "ok", "error":
+		if value.Type != Result || value.Data.(ResultValue).Ok != (patternList[0].Data.(string) == "ok") {
+			return false, nil
+		}
+		return matchPattern(patternList[1], value.Data.(ResultValue).Value, env, bindings, true)
+
+	case "list":
+		if value.Type != List || len(value.Data.([]Value)) != len(patternList)-1 {
+			return false, nil
+		}
+		return matchPatterns(patternList[1:], value.Data.([]Value), env, bindings)
+
+	case "cons":
+		if value.Type != List || len(value.Data.([]Value)) == 0 {
+			return false, nil
+		}
+		list := value.Data.([]Value)
+		matched, err := matchPattern(patternList[1], list[0], env, bindings, true)
+		if err != nil || !matched {
+			return false, err
+		}
+		return matchPattern(patternList[2], Value{
+			Type:        List,
+			Data:        list[1:],
+			PreventEval: true,
+		}, env, bindings, true)
+	}
+
+	definition, _ := env.Get(patternList[0].Data.(string))
+	if value.Type != Struct || value.Data.(StructData).Definition != definition.Data.(*StructDefinitionData) {
+		return false, nil
+	}
+	if len(patternList)-1 != len(definition.Data.(*StructDefinitionData).Fields) {
+		return false, errors.New("incorrect number of fields in struct pattern")
+	}
+	return matchPatterns(patternList[1:], value.Data.(StructData).Values, env, bindings)
+}
+
+// matchPatterns matches each value against the pattern in the same position.
+func matchPatterns(
+	patterns []Value,
+	values []Value,
+	env *Environment,
+	bindings *Environment,
+) (
+	bool,
+	error,
+) {
+	for i, pattern := range patterns {
+		matched, err := matchPattern(pattern, values[i], env, bindings, true)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isIrrefutable reports whether a pattern inside a destructuring pattern matches every value. Any symbol binds the value in its place, except none which only matches an empty option.
+func isIrrefutable(
+	pattern Value,
+) bool {
+	return pattern.Type == Symbol && pattern.Data.(string) != "none"
+}
+
+// checkOptionExhaustive returns an error if the patterns do not handle both a some and a none value.
+func checkOptionExhaustive(
+	patterns []Value,
+) error {
+	coversSome, coversNone := false, false
+	for _, pattern := range patterns {
+		if pattern.Type == Symbol {
+			switch pattern.Data.(string) {
+			case "_":
+				return nil
+			case "none":
+				coversNone = true
+			}
+			continue
+		}
+		if pattern.Type != List {
+			continue
+		}
+		patternList := pattern.Data.([]Value)
+		if len(patternList) == 2 && patternList[0].Type == Symbol && patternList[0].Data.(string) == "some" && isIrrefutable(patternList[1]) {
+			coversSome = true
+		}
+	}
+	if !coversSome && !coversNone {
+		return errors.New("non-exhaustive match over option: missing [some _] and none")
+	}
+	if !coversSome {
+		return errors.New("non-exhaustive match over option: missing [some _]")
+	}
+	if !coversNone {
+		return errors.New("non-exhaustive match over option: missing none")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestPatterns(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail(`
+		[define unwrap
+			[function [value]
+				[match value
+					[[some x] x]
+					[none 1]
+				]
+			]
+		]
+	`, env, t)
+	_ = evaluateOrFail("[define point [struct [int x] [int y]]]", env, t)
+	env.Set("numbers", Value{
+		Type: List,
+		Data: []Value{
+			{Type: Int, Data: int64(1)},
+			{Type: Int, Data: int64(2)},
+			{Type: Int, Data: int64(3)},
+		},
+		PreventEval: true,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[unwrap [some 5]]", "int<5>"},
+		{"[unwrap none]", "int<1>"},
+		{"[match [some [some 2]] [[some [some x]] x] [_ 0]]", "int<2>"},
+		{"[match [some 3] [[some 2] 'two'] [[some 3] 'three'] [[some _] 'other'] [none 'none']]", "string<three>"},
+		{"[match [ok [some 4]] [[ok [some x]] x] [[ok none] 0] [[error e] e]]", "int<4>"},
+		{"[match numbers [[list a b] a] [[list a b c] c] [_ 0]]", "int<3>"},
+		{"[match numbers [[list 1 _ x] x] [_ 0]]", "int<3>"},
+		{"[match numbers [[cons head tail] tail] [_ 0]]", "list<int<2> int<3>>"},
+		{"[match numbers [[cons 1 [cons second _]] second] [_ 0]]", "int<2>"},
+		{"[match [point 1 2] [[point 1 y] y] [_ 0]]", "int<2>"},
+		{"[match [point 3 2] [[point 1 y] y] [[point x _] x]]", "int<3>"},
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+
+	// Bindings do not leak out of their clause.
+	_ = evaluateOrFail("[match [some 1] [[some leaked] leaked] [none 0]]", env, t)
+	if _, err := env.Get("leaked"); err == nil {
+		t.Errorf("expected the binding to only exist in the clause")
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[match [some 1] [[some x] x]]", "<test>:1:1 non-exhaustive match over option: missing none"},
+		{"[match none [none 0]]", "<test>:1:1 non-exhaustive match over option: missing [some _]"},
+		{"[match [some 1] [[some 1] 1]]", "<test>:1:1 non-exhaustive match over option: missing [some _] and none"},
+		{"[match [some 1] [[some none] 1] [none 0]]", "<test>:1:1 non-exhaustive match over option: missing [some _]"},
+		{"[match [point 1 2] [[point x] x] [_ 0]]", "<test>:1:1 incorrect number of fields in struct pattern"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"strings"
 )
 
-func Repl() {
-	env := NewEnv(nil)
-	AddBuiltins(env)
+// Repl reads expressions from the standard input and evaluates them in an environment of the interpreter, one per line.
+func (
+	i *Interpreter,
+) Repl() {
+	env := i.NewEnv()
+	inference := NewInference()
 	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Println("Type 'exit' to quit.")
 	for {
@@ -25,12 +28,34 @@ func Repl() {
 			continue
 		}
 
-		expression, err := Parse(line, "<repl>", nil)
+		expression, err := i.Parse(line, "<repl>", nil)
 		if err != nil {
 			fmt.Println("Parse error:", err)
 			continue
 		}
-		result, err := Evaluate(expression, env)
+		diagnostics := Check(expression, env)
+		for _, diagnostic := range diagnostics {
+			fmt.Println("Check error:", diagnostic)
+		}
+		if len(diagnostics) > 0 {
+			continue
+		}
+		// Type errors are reported but do not stop the line from being evaluated, as the language is checked at runtime and inference can not type every valid program.
+		inferred, diagnostics := inference.Infer(expression)
+		for _, diagnostic := range diagnostics {
+			fmt.Println("Type error:", diagnostic)
+		}
+		if len(diagnostics) == 0 {
+			fmt.Println("Type:", inferred)
+		}
+		expression = Optimise(expression, env)
+		var result Value
+		if program, compileErr := Compile(expression, env); compileErr == nil {
+			result, err = i.Run(program)
+		} else {
+			// Expressions the virtual machine does not support are evaluated by walking them instead.
+			result, err = i.Evaluate(expression, env)
+		}
 		if err != nil {
 			fmt.Println("Eval error:", err)
 			continue
@@ -0,0 +1,47 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestResults(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail(`
+		[define safe-divide
+			[function [a b]
+				[match [int-divide a b]
+					[[ok quotient] quotient]
+					[[error message] message]
+				]
+			]
+		]
+	`, env, t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[ok [int-add 1 2]]", "ok<int<3>>"},
+		{"[error 'failed']", "error<string<failed>>"},
+		{"[int-divide 7 2]", "ok<int<3>>"},
+		{"[int-divide -7 2]", "ok<int<-3>>"},
+		{"[int-divide 7 0]", "error<string<division by zero>>"},
+		{"[int-parse '-12']", "ok<int<-12>>"},
+		{"[int-parse 'twelve']", "error<string<'twelve' is not an integer>>"},
+		{"[safe-divide 6 3]", "int<2>"},
+		{"[safe-divide 6 0]", "string<division by zero>"},
+		{"[match [int-parse '1'] [[error _] false] [[ok 1] true]]", "bool<true>"},
+		{"[match [error 1] [[ok _] 1] [_ 2]]", "int<2>"},
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+}
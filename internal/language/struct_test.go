@@ -0,0 +1,52 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestStructs(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+
+	_ = evaluateOrFail("[define file-data [struct [integer size-in-bytes] [string name] [string extension]]]", env, t)
+	_ = evaluateOrFail("[define readme [file-data 1024 'readme' 'md']]", env, t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"readme", "struct<size-in-bytes=int<1024> name=string<readme> extension=string<md>>"},
+		{"[struct-get readme name]", "string<readme>"},
+		{"[struct-set readme size-in-bytes [int-add 1 2] extension 'txt']", "struct<size-in-bytes=int<3> name=string<readme> extension=string<txt>>"},
+		{"[struct-get readme size-in-bytes]", "int<1024>"},
+		{"[match readme [[file-data 1024 'readme' 'md'] true] [_ false]]", "bool<true>"},
+		{"[match [struct-set readme name 'license'] [[file-data 1024 'readme' 'md'] true] [_ false]]", "bool<false>"},
+	}
+	for _, test := range tests {
+		result := evaluateOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[file-data 'big' 'readme' 'md']", "<test>:1:1 struct field 'size-in-bytes' expects int, got string"},
+		{"[file-data 1 'readme']", "<test>:1:1 incorrect number of fields for struct"},
+		{"[struct-get readme path]", "<test>:1:1 struct has no field 'path'"},
+		{"[struct-set readme name 1]", "<test>:1:1 struct field 'name' expects string, got int"},
+		{"[struct [int x] [int x]]", "<test>:1:1 struct field 'x' is defined more than once"},
+		{"[struct-get 1 name]", "<test>:1:1 expected a struct, got int"},
+	}
+	for _, test := range errorTests {
+		err := evaluateError(test.input, env, t)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,620 @@
+package language
+
+import (
+	"errors"
+)
+
+// vm runs compiled programs. Values on its stack are always concrete, arguments that are not evaluated yet are only found in the slots of parameters.
+type vm struct {
+	env   *Environment
+	stack []Value
+}
+
+// vmFrame holds the slots of a call to a compiled function. Parent is the frame the function was defined in.
+type vmFrame struct {
+	function *vmFunction
+	slots    []Value
+	parent   *vmFrame
+}
+
+// vmClosure is a compiled function together with the frame it was defined in.
+type vmClosure struct {
+	function *vmFunction
+	parent   *vmFrame
+	vm       *vm
+}
+
+// vmThunk is an argument that is evaluated the first time its parameter is used. It runs the code of the argument in the frame of the call, or evaluates the expression of an argument given by Evaluate. Like a LazyData, it keeps its value or error once done.
+type vmThunk struct {
+	frame      *vmFrame
+	ip         int
+	expression Value
+	env        *Environment
+	value      Value
+	err        error
+	done       bool
+}
+
+// activation is a call that is running. The caller continues at returnIP once it returns.
+type activation struct {
+	frame    *vmFrame
+	site     *callSite
+	returnIP int
+}
+
+// Run evaluates the program in the environment it was compiled for.
+func (
+	p *Program,
+) Run() (
+	Value,
+	error,
+) {
+	machine := &vm{
+		env: p.env,
+	}
+	return machine.run(&vmFrame{
+		function: p.main,
+		slots:    make([]Value, p.main.Slots),
+	}, 0)
+}
+
+func (
+	m *vm,
+) push(
+	value Value,
+) {
+	m.stack = append(m.stack, value)
+}
+
+func (
+	m *vm,
+) pop() Value {
+	value := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return value
+}
+
+// run runs code in a frame starting at an instruction, until the function returns or the code of an argument ends. Calls to compiled functions are run in the same loop.
+func (
+	m *vm,
+) run(
+	frame *vmFrame,
+	ip int,
+) (
+	Value,
+	error,
+) {
+	base := len(m.stack)
+	calls := []activation{{
+		frame: frame,
+	}}
+	// The run and the calls it makes count towards the depth of the interpreter, which is restored when the run ends.
+	interpreter := m.env.interpreter
+	depth := interpreter.depth
+	defer func() {
+		interpreter.depth = depth
+	}()
+	if err := interpreter.enter(); err != nil {
+		return Value{}, err
+	}
+	code := frame.function.Code
+	for {
+		in := &code[ip]
+		ip++
+
+		err := interpreter.step()
+		if err != nil {
+			m.stack = m.stack[:base]
+			return Value{}, m.unwind(err, in.Position, calls)
+		}
+		switch in.Op {
+		case OpConstant:
+			m.push(frame.function.Constants[in.A])
+
+		case OpLoadLocal:
+			slotFrame := frame
+			for depth := in.A; depth > 0; depth-- {
+				slotFrame = slotFrame.parent
+			}
+			var value Value
+			value, err = m.force(slotFrame, in.B)
+			if err == nil && value.Type == Unknown {
+				err = errors.New("undefined symbol '" + frame.function.Names[in.C] + "'")
+			}
+			m.push(value)
+
+		case OpStoreLocal:
+			frame.slots[in.A] = m.stack[len(m.stack)-1]
+
+		case OpLoadGlobal:
+			var value Value
+			value, err = m.env.Get(frame.function.Names[in.A])
+			if err == nil && (value.Type == Lazy || (value.Type == List && !value.PreventEval)) {
+				value, err = EvaluateUntilConcrete(value, m.env)
+			}
+			m.push(value)
+
+		case OpDefineGlobal:
+			defineValue(frame.function.Names[in.A], m.stack[len(m.stack)-1], m.env)
+
+		case OpPop:
+			m.pop()
+
+		case OpJump:
+			ip = in.A
+
+		case OpJumpIfFalse:
+			if !isTruthy(m.pop()) {
+				ip = in.A
+			}
+
+		case OpClosure:
+			m.push(m.closure(frame.function.Functions[in.A], frame))
+
+		case OpCall:
+			site := &frame.function.CallSites[in.A]
+			callee := m.pop()
+			closure := compiledClosure(callee)
+			if closure == nil || closure.vm.env != m.env {
+				var result Value
+				result, err = m.callValue(callee, site, frame)
+				m.push(result)
+				ip = site.End
+				break
+			}
+
+			var calleeFrame *vmFrame
+			calleeFrame, err = m.enter(closure, site, frame, site.Tail && closure.function == frame.function)
+			if err != nil {
+				break
+			}
+			if site.Tail && len(calls) > 1 && (frame.function.ReturnCheck.Type == Unknown || frame.function.ReturnCheck == calleeFrame.function.ReturnCheck) {
+				// The callee takes the place of the caller, whose result it would be, so recursion in tail position runs in constant space.
+				calls[len(calls)-1].frame = calleeFrame
+				calls[len(calls)-1].site = site
+				frame = calleeFrame
+				code = frame.function.Code
+				ip = 0
+				break
+			}
+			if err = interpreter.enter(); err != nil {
+				break
+			}
+			calls = append(calls, activation{
+				frame:    calleeFrame,
+				site:     site,
+				returnIP: site.End,
+			})
+			frame = calleeFrame
+			code = frame.function.Code
+			ip = 0
+
+		case OpEndArgument:
+			return m.pop(), nil
+
+		case OpReturn:
+			value := m.pop()
+			value, err = checkReturn(value, m.env, frame.function.ReturnCheck)
+			if err != nil {
+				break
+			}
+			if len(calls) == 1 {
+				return value, nil
+			}
+			returnIP := calls[len(calls)-1].returnIP
+			calls = calls[:len(calls)-1]
+			interpreter.leave()
+			frame = calls[len(calls)-1].frame
+			code = frame.function.Code
+			ip = returnIP
+			m.push(value)
+
+		case OpBuiltin:
+			args := make([]Value, in.B)
+			copy(args, m.stack[len(m.stack)-in.B:])
+			m.stack = m.stack[:len(m.stack)-in.B]
+			var result Value
+			result, err = frame.function.Constants[in.A].Data.(func([]Value, *Environment) (Value, error))(args, m.env)
+			if err == nil {
+				result, err = EvaluateUntilConcrete(result, m.env)
+			}
+			m.push(result)
+
+		case OpIntAdd, OpIntSubtract:
+			args := m.stack[len(m.stack)-in.A:]
+			var result int64
+			for index, arg := range args {
+				if arg.Type != Int {
+					if in.Op == OpIntAdd {
+						err = errors.New("arguments to int-add must be integers")
+					} else {
+						err = errors.New("arguments to int-subtract must be integers")
+					}
+					break
+				}
+				if in.Op == OpIntAdd || index == 0 {
+					result += arg.Data.(int64)
+				} else {
+					result -= arg.Data.(int64)
+				}
+			}
+			m.stack = m.stack[:len(m.stack)-in.A]
+			m.push(Value{
+				Type: Int,
+				Data: result,
+			})
+
+		case OpCheckParameter:
+			var value Value
+			value, err = m.force(frame, in.A)
+			if err == nil {
+				err = checkParameter(frame.function.Parameters[in.A], value)
+			}
+
+		case OpGuard:
+			if !isTruthy(m.pop()) {
+				err = &guardError{
+					Definition: frame.function.Definition,
+				}
+			}
+
+		case OpEqual:
+			b := m.pop()
+			a := m.pop()
+			m.push(Value{
+				Type: Bool,
+				Data: valueEqual(a, b, m.env),
+			})
+
+		case OpIsNone:
+			value := frame.slots[in.A]
+			m.push(Value{
+				Type: Bool,
+				Data: value.Type == Option && !value.Data.(OptionValue).Some,
+			})
+
+		case OpUnwrapSome, OpUnwrapOk, OpUnwrapError:
+			value := frame.slots[in.A]
+			matched := false
+			switch {
+			case value.Type == Option && in.Op == OpUnwrapSome:
+				option := value.Data.(OptionValue)
+				matched = option.Some
+				frame.slots[in.B] = option.Value
+			case value.Type == Result && in.Op != OpUnwrapSome:
+				result := value.Data.(ResultValue)
+				matched = result.Ok == (in.Op == OpUnwrapOk)
+				frame.slots[in.B] = result.Value
+			}
+			m.push(Value{
+				Type: Bool,
+				Data: matched,
+			})
+
+		case OpUnwrapList, OpUnwrapCons:
+			value := frame.slots[in.A]
+			var elements []Value
+			if value.Type == List {
+				elements = value.Data.([]Value)
+			}
+			matched := false
+			switch {
+			case value.Type != List:
+			case in.Op == OpUnwrapList:
+				matched = len(elements) == in.C
+				if matched {
+					copy(frame.slots[in.B:], elements)
+				}
+			case len(elements) > 0:
+				matched = true
+				frame.slots[in.B] = elements[0]
+				frame.slots[in.B+1] = Value{
+					Type:        List,
+					Data:        elements[1:],
+					PreventEval: true,
+				}
+			}
+			m.push(Value{
+				Type: Bool,
+				Data: matched,
+			})
+
+		case OpUnwrapStruct:
+			value := frame.slots[in.A]
+			matched := value.Type == Struct && value.Data.(StructData).Definition == frame.function.Constants[in.C].Data.(*StructDefinitionData)
+			if matched {
+				copy(frame.slots[in.B:], value.Data.(StructData).Values)
+			}
+			m.push(Value{
+				Type: Bool,
+				Data: matched,
+			})
+
+		case OpFail:
+			err = errors.New(frame.function.Constants[in.A].Data.(string))
+
+		case OpImport:
+			data := frame.function.Constants[in.A].Data.(ImportData)
+			var result Value
+			result, err = evaluateImport(data, m.env)
+			if err != nil {
+				err = runtimeError(err, in.Position, &StackFrame{
+					Name:     "import " + data.Module.FileName,
+					Position: in.Position,
+				})
+			}
+			m.push(result)
+
+		case OpCheckOption:
+			if frame.slots[in.A].Type == Option {
+				err = errors.New(frame.function.Constants[in.B].Data.(string))
+			}
+		}
+
+		if err != nil {
+			m.stack = m.stack[:base]
+			return Value{}, m.unwind(err, in.Position, calls)
+		}
+	}
+}
+
+// unwind adds the position of the failed instruction and the calls that were running to an error. A guard that did not pass in the function that run was called for is returned as it is, so an overload set can try the next candidate.
+func (
+	m *vm,
+) unwind(
+	err error,
+	position *Position,
+	calls []activation,
+) error {
+	if _, ok := err.(*guardError); ok {
+		if len(calls) == 1 {
+			return err
+		}
+		err = errors.New(err.Error())
+	}
+	err = runtimeError(err, position, nil)
+	for index := len(calls) - 1; index > 0; index-- {
+		site := calls[index].site
+		err = runtimeError(err, site.Position, &StackFrame{
+			Name:     site.Name,
+			Position: site.Position,
+		})
+	}
+	return err
+}
+
+// force returns the value in a slot, evaluating the argument it holds if that has not happened yet.
+func (
+	m *vm,
+) force(
+	frame *vmFrame,
+	slot int,
+) (
+	Value,
+	error,
+) {
+	value := frame.slots[slot]
+	if value.Type != Lazy {
+		return value, nil
+	}
+	value, err := m.evaluateThunk(value.Data.(*vmThunk))
+	if err != nil {
+		return Value{}, err
+	}
+	frame.slots[slot] = value
+	return value, nil
+}
+
+// evaluateThunk returns the value of an argument, evaluating it if that has not happened yet.
+func (
+	m *vm,
+) evaluateThunk(
+	thunk *vmThunk,
+) (
+	Value,
+	error,
+) {
+	if !thunk.done {
+		var value Value
+		var err error
+		if thunk.frame != nil {
+			value, err = m.run(thunk.frame, thunk.ip)
+		} else {
+			value, err = EvaluateUntilConcrete(thunk.expression, thunk.env)
+		}
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			// A limit belongs to the run rather than the argument, a later run can still evaluate it.
+			return Value{}, err
+		}
+		thunk.value = value
+		thunk.err = err
+		thunk.done = true
+		thunk.frame = nil
+		thunk.expression = Value{}
+		thunk.env = nil
+	}
+	return thunk.value, thunk.err
+}
+
+// enter creates the frame for a call to a compiled function. Arguments of parameters that are always used are evaluated now, the others when they are first used. A function calling itself in tail position evaluates all of its arguments now, like Evaluate does.
+func (
+	m *vm,
+) enter(
+	closure *vmClosure,
+	site *callSite,
+	caller *vmFrame,
+	selfCall bool,
+) (
+	*vmFrame,
+	error,
+) {
+	function := closure.function
+	if len(site.Arguments) != len(function.Parameters) {
+		return nil, errors.New("incorrect number of arguments")
+	}
+	frame := &vmFrame{
+		function: function,
+		slots:    make([]Value, function.Slots),
+		parent:   closure.parent,
+	}
+	for index, start := range site.Arguments {
+		if !function.Strict[index] && !selfCall {
+			frame.slots[index] = Value{
+				Type: Lazy,
+				Data: &vmThunk{
+					frame: caller,
+					ip:    start,
+				},
+			}
+			continue
+		}
+		value, err := m.run(caller, start)
+		if err != nil {
+			return nil, err
+		}
+		frame.slots[index] = value
+	}
+	return frame, nil
+}
+
+// callValue calls a value that is not a compiled function of this program, such as a struct definition or a function created by Evaluate. Functions get their arguments as thunks, which they evaluate when they are first used like they would in Evaluate, other values get them evaluated.
+func (
+	m *vm,
+) callValue(
+	callee Value,
+	site *callSite,
+	caller *vmFrame,
+) (
+	Value,
+	error,
+) {
+	args := make([]Value, len(site.Arguments))
+	_, isFunction := callee.Data.(FunctionData)
+	_, isOverload := callee.Data.(OverloadData)
+	for index, start := range site.Arguments {
+		if isFunction || isOverload {
+			thunk := &vmThunk{
+				frame: caller,
+				ip:    start,
+			}
+			args[index] = Value{
+				Type: Lazy,
+				Data: &LazyData{
+					force: func() (Value, error) {
+						return m.evaluateThunk(thunk)
+					},
+				},
+			}
+			continue
+		}
+		value, err := m.run(caller, start)
+		if err != nil {
+			return Value{}, err
+		}
+		args[index] = value
+	}
+
+	if callee.Type == StructDefinition {
+		return constructStruct(callee.Data.(*StructDefinitionData), args, m.env)
+	}
+	if callee.Type != Function && callee.Type != Procedure {
+		return Value{}, errors.New("first element in list is not a function, procedure or struct")
+	}
+
+	var result Value
+	var err error
+	frame := &StackFrame{
+		Name:     site.Name,
+		Position: site.Position,
+	}
+	switch function := callee.Data.(type) {
+	case func([]Value, *Environment) (Value, error):
+		frame = nil
+		result, err = function(args, m.env)
+	case FunctionData:
+		result, err = function.Call(args, m.env)
+		if guardErr, ok := err.(*guardError); ok {
+			err = errors.New(guardErr.Error())
+		}
+	case OverloadData:
+		result, err = function.call(args, m.env)
+	default:
+		return Value{}, errors.New("function or procedure is not callable")
+	}
+	if err == nil {
+		result, err = EvaluateUntilConcrete(result, m.env)
+	}
+	if err != nil {
+		return Value{}, runtimeError(err, site.Position, frame)
+	}
+	return result, nil
+}
+
+// compiledClosure returns the compiled function of a value, or nil if it is not one.
+func compiledClosure(
+	value Value,
+) *vmClosure {
+	if function, ok := value.Data.(FunctionData); ok {
+		return function.compiled
+	}
+	return nil
+}
+
+// closure creates a function or procedure value from a compiled function. The value can be called by Evaluate as well, in which case the arguments of parameters that are not always used are evaluated when they are first used.
+func (
+	m *vm,
+) closure(
+	function *vmFunction,
+	parent *vmFrame,
+) Value {
+	closure := &vmClosure{
+		function: function,
+		parent:   parent,
+		vm:       m,
+	}
+	return Value{
+		Type: function.Kind,
+		Data: FunctionData{
+			Parameters: function.Parameters,
+			Guard:      function.Guard,
+			ReturnType: function.ReturnCheck.Type,
+			Definition: function.Definition,
+			Call: func(
+				args []Value,
+				env *Environment,
+			) (
+				Value,
+				error,
+			) {
+				if len(args) != len(function.Parameters) {
+					return Value{}, errors.New("incorrect number of arguments")
+				}
+				frame := &vmFrame{
+					function: function,
+					slots:    make([]Value, function.Slots),
+					parent:   parent,
+				}
+				for index, arg := range args {
+					if !function.Strict[index] && (arg.Type == Lazy || arg.Type == List || arg.Type == Symbol) {
+						frame.slots[index] = Value{
+							Type: Lazy,
+							Data: &vmThunk{
+								expression: arg,
+								env:        env,
+							},
+						}
+						continue
+					}
+					value, err := EvaluateUntilConcrete(arg, env)
+					if err != nil {
+						return Value{}, err
+					}
+					frame.slots[index] = value
+				}
+				return closure.vm.run(frame, 0)
+			},
+			compiled: closure,
+		},
+	}
+}
@@ -0,0 +1,405 @@
+package language
+
+import (
+	"errors"
+	"testing"
+)
+
+// runOrFail is a helper that parses, compiles and runs a source string in the given environment. It fails the test if there is a parse, compile or runtime error.
+func runOrFail(
+	input string,
+	env *Environment,
+	t testing.TB,
+) Value {
+	expression, err := Parse(input, "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error in input %q: %v", input, err)
+	}
+	program, err := Compile(expression, env)
+	if err != nil {
+		t.Fatalf("Compile error in input %q: %v", input, err)
+	}
+	result, err := program.Run()
+	if err != nil {
+		t.Fatalf("Run error in input %q: %v", input, err)
+	}
+	return result
+}
+
+// runError is a helper that parses, compiles and runs a source string in the given environment and returns the runtime error. It fails the test if there is a parse or compile error.
+func runError(
+	input string,
+	env *Environment,
+	t *testing.T,
+) error {
+	expression, err := Parse(input, "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error in input %q: %v", input, err)
+	}
+	program, err := Compile(expression, env)
+	if err != nil {
+		t.Fatalf("Compile error in input %q: %v", input, err)
+	}
+	_, err = program.Run()
+	return err
+}
+
+const fibonacciDefinition = `
+	[define calc-fib
+		[function [n]
+			[match n
+				[0 0]
+				[1 1]
+				[_
+					[int-add
+						[calc-fib
+							[int-subtract n 1]
+						]
+						[calc-fib
+							[int-subtract n 2]
+						]
+					]
+				]
+			]
+		]
+	]
+`
+
+func TestVMFibonacci(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	_ = runOrFail(fibonacciDefinition, env, t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[calc-fib 0]", "int<0>"},
+		{"[calc-fib 1]", "int<1>"},
+		{"[calc-fib 2]", "int<1>"},
+		{"[calc-fib 3]", "int<2>"},
+		{"[calc-fib 4]", "int<3>"},
+		{"[calc-fib 5]", "int<5>"},
+		{"[calc-fib 6]", "int<8>"},
+		{"[calc-fib 7]", "int<13>"},
+	}
+
+	for _, test := range tests {
+		result := runOrFail(test.input, env, t)
+		resultString := valueToString(result)
+		if resultString != test.expected {
+			t.Errorf("For %s: expected %s, got %s", test.input, test.expected, resultString)
+		}
+	}
+}
+
+func TestVMMatchesEvaluate(
+	t *testing.T,
+) {
+	definitions := []string{
+		"[define double [function int [int n] [int-add n n]]]",
+		"[define label [procedure [string name int id] name]]",
+		"[define apply [function [function f int n] [f n]]]",
+		"[define wrong [function int [x] x]]",
+		"[define describe [function [int n] 'int']]",
+		"[define describe [function [string s] 'text']]",
+		"[define describe [function [a b] 'pair']]",
+		"[define is-zero [function [n] [match n [0 true] [_ false]]]]",
+		"[define only-zero [procedure [n when [is-zero n]] n]]",
+		"[define unwrap [function [o] [match o [[some v] v] [none 0]]]]",
+		"[define check [function [r] [match r [[ok [some v]] v] [[ok none] 'empty'] [[error e] e]]]]",
+		"[define point [struct [int x] [int y]]]",
+		"[define adder [function [n] [function [m] [int-add n m]]]]",
+		"[define first [function [a b] a]]",
+		"[define inner-define [function [n] [if [define doubled [int-add n n]] doubled]]]",
+		"[define bound [function [x o] [match o [none 0] [[some x] x]]]]",
+		"[define caught [function [x y] [match y [1 0] [x 5]]]]",
+		"[define shadowed [function [x] [int-add [define x 5] x]]]",
+		"[define count [function [n x] [if [is-zero n] 'done' [count [int-subtract n 1] x]]]]",
+		"[define count-unused [function [n x] [match n [0 'done'] [_ [count-unused [int-subtract n 1] [int-add 'x']]]]]]",
+		"[define pick [function [a b] a]]",
+		"[define pick [function [int a] a]]",
+		"[define sum-point [function [p] [match p [[point x y] [int-add x y]] [_ 0]]]]",
+		"[define wrong-point [function [p] [match p [[point x] x] [_ 0]]]]",
+		"[define first-two [function [l] [match l [[list a b] [int-add a b]] [[cons h [cons s t]] [list-length t]] [_ 0]]]]",
+		"[define head [function [l] [match l [[cons h t] [some h]] [_ none]]]]",
+		"[define nested [function [l] [match l [[list [some a] _] a] [[list none _] 0] [_ -1]]]]",
+	}
+	// The functions from Evaluate are called by the virtual machine, and the compiled functions by Evaluate.
+	evaluated := []string{
+		"[define evaluated-first [function [a b] a]]",
+	}
+	compiled := []string{
+		"[define compiled-first [function [a b] a]]",
+		"[define compiled-double [function [n] [int-add n n]]]",
+	}
+	inputs := []string{
+		"[double 2]",
+		"[double [int-add 1 2]]",
+		"[label 'player' 1]",
+		"[apply double 3]",
+		"[describe 1]",
+		"[describe 'one']",
+		"[describe 'one' 2]",
+		"[is-zero 0]",
+		"[only-zero 0]",
+		"[unwrap [some 4]]",
+		"[unwrap none]",
+		"[check [ok [some 'value']]]",
+		"[check [ok none]]",
+		"[check [error 'failed']]",
+		"[check [int-divide 1 0]]",
+		"[struct-get [struct-set [point 1 2] x 3] x]",
+		"[[adder 1] 2]",
+		"[first 1 missing]",
+		"[inner-define 4]",
+		"[bound [undefined-fn] [some 7]]",
+		"[caught [undefined-fn] 1]",
+		"[caught [undefined-fn] 2]",
+		"[shadowed [undefined-fn]]",
+		"[count 0 [undefined-fn]]",
+		"[count 2 [undefined-fn]]",
+		"[count-unused 0 1]",
+		"[count-unused 1 1]",
+		"[pick 1 [int-add 'x']]",
+		"[pick 1]",
+		"[evaluated-first 1 missing]",
+		"[evaluated-first missing 1]",
+		"[compiled-first 1 missing]",
+		"[compiled-first 1 [int-add 'x']]",
+		"[compiled-first missing 1]",
+		"[compiled-double [evaluated-first 2 missing]]",
+		"[evaluated-first [compiled-first 3 missing] missing]",
+		"[sum-point [point 1 2]]",
+		"[sum-point 3]",
+		"[wrong-point [point 1 2]]",
+		"[wrong-point 3]",
+		"[first-two [list 1 2]]",
+		"[first-two [list 5 6 7 8]]",
+		"[first-two []]",
+		"[head [list 1 2]]",
+		"[head []]",
+		"[head 'text']",
+		"[nested [list [some 4] 1]]",
+		"[nested [list none 1]]",
+		"[nested [list 1]]",
+		"[if none 1]",
+		"[match 3 [1 'one'] [2 'two']]",
+		"[double 'two']",
+		"[wrong 'one']",
+		"[only-zero 1]",
+		"[describe true]",
+		"[unwrap 1]",
+		"[first missing 1]",
+		"[1 2]",
+		"[point 1]",
+	}
+
+	evaluateEnv := NewEnv(nil)
+	AddBuiltins(evaluateEnv)
+	runEnv := NewEnv(nil)
+	AddBuiltins(runEnv)
+	for _, definition := range definitions {
+		_ = evaluateOrFail(definition, evaluateEnv, t)
+		_ = runOrFail(definition, runEnv, t)
+	}
+	for _, definition := range evaluated {
+		_ = evaluateOrFail(definition, evaluateEnv, t)
+		_ = evaluateOrFail(definition, runEnv, t)
+	}
+	for _, definition := range compiled {
+		_ = runOrFail(definition, evaluateEnv, t)
+		_ = runOrFail(definition, runEnv, t)
+	}
+
+	for _, input := range inputs {
+		expression, err := Parse(input, "<test>", nil)
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", input, err)
+		}
+		expected, expectedErr := EvaluateUntilConcrete(expression, evaluateEnv)
+		program, err := Compile(expression, runEnv)
+		if err != nil {
+			t.Fatalf("Compile error in input %q: %v", input, err)
+		}
+		result, err := program.Run()
+
+		if (err == nil) != (expectedErr == nil) {
+			t.Errorf("For %s: expected error %v, got %v", input, expectedErr, err)
+			continue
+		}
+		if err != nil {
+			// The messages agree, but the virtual machine evaluates arguments at other moments so the stack can differ.
+			if err.(*RuntimeError).Message != expectedErr.(*RuntimeError).Message {
+				t.Errorf("For %s: expected error %q, got %q", input, expectedErr.(*RuntimeError).Message, err.(*RuntimeError).Message)
+			}
+			continue
+		}
+		if valueToString(result) != valueToString(expected) {
+			t.Errorf("For %s: expected %s, got %s", input, valueToString(expected), valueToString(result))
+		}
+	}
+}
+
+func TestVMErrors(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	_ = runOrFail("[define inner [function [n] [int-add n missing]]]", env, t)
+	_ = runOrFail("[define outer [function [n] [int-add [inner n] 1]]]", env, t)
+
+	err := runError("[outer 1]", env, t)
+	expected := "<test>:1:40 undefined symbol 'missing'\n  in inner at <test>:1:38\n  in outer at <test>:1:1"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestVMThunkError(
+	t *testing.T,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	calls := 0
+	env.Set("fail", Value{
+		Type: Function,
+		Data: func(
+			args []Value,
+			env *Environment,
+		) (
+			Value,
+			error,
+		) {
+			calls++
+			return Value{}, errors.New("failed")
+		},
+	})
+	expression, err := Parse("[fail]", "<test>", nil)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	machine := &vm{
+		env: env,
+	}
+	thunk := &vmThunk{
+		expression: expression,
+		env:        env,
+	}
+	_, _ = machine.evaluateThunk(thunk)
+	_, err = machine.evaluateThunk(thunk)
+	if err == nil || err.Error() != "<test>:1:1 failed" {
+		t.Errorf("expected error %q, got %v", "<test>:1:1 failed", err)
+	}
+	if calls != 1 {
+		t.Errorf("the failing argument was evaluated %d times, expected once", calls)
+	}
+}
+
+func TestVMImports(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"math": "[define increment [function [n] [int-add n 1]]]",
+	}
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	expression, err := Parse("[import 'math' as m]", "<test>", mapResolver(files))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	program, err := Compile(expression, env)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	if _, err := program.Run(); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if result := runOrFail("[m-increment 1]", env, t); valueToString(result) != "int<2>" {
+		t.Errorf("[m-increment 1] = %s, expected int<2>", valueToString(result))
+	}
+}
+
+func TestCompileUnsupported(
+	t *testing.T,
+) {
+	files := map[string]string{
+		"math": "[define increment [function [n] [int-add n 1]]]",
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[[function [] [if [import 'math'] 1 [increment 1]]]]", "the virtual machine does not support imports inside functions and match clauses"},
+		{"[match 1 [1 [if [import 'math'] 1 [increment 1]]]]", "the virtual machine does not support imports inside functions and match clauses"},
+	}
+
+	for _, test := range tests {
+		env := NewEnv(nil)
+		AddBuiltins(env)
+		expression, err := Parse(test.input, "<test>", mapResolver(files))
+		if err != nil {
+			t.Fatalf("Parse error in input %q: %v", test.input, err)
+		}
+		_, err = Compile(expression, env)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("For %s: expected error %q, got %v", test.input, test.expected, err)
+		}
+		// Like the REPL, a program the virtual machine does not support can be evaluated instead.
+		result, err := EvaluateUntilConcrete(expression, env)
+		if err != nil || valueToString(result) != "int<2>" {
+			t.Errorf("For %s: expected Evaluate to give int<2>, got %s %v", test.input, valueToString(result), err)
+		}
+	}
+}
+
+func BenchmarkFibonacciEvaluate(
+	b *testing.B,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	expression, err := Parse(fibonacciDefinition, "<test>", nil)
+	if err != nil {
+		b.Fatalf("Parse error: %v", err)
+	}
+	if _, err := EvaluateUntilConcrete(expression, env); err != nil {
+		b.Fatalf("Eval error: %v", err)
+	}
+	call, err := Parse("[calc-fib 20]", "<test>", nil)
+	if err != nil {
+		b.Fatalf("Parse error: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EvaluateUntilConcrete(call, env); err != nil {
+			b.Fatalf("Eval error: %v", err)
+		}
+	}
+}
+
+func BenchmarkFibonacciVM(
+	b *testing.B,
+) {
+	env := NewEnv(nil)
+	AddBuiltins(env)
+	_ = runOrFail(fibonacciDefinition, env, b)
+	call, err := Parse("[calc-fib 20]", "<test>", nil)
+	if err != nil {
+		b.Fatalf("Parse error: %v", err)
+	}
+	program, err := Compile(call, env)
+	if err != nil {
+		b.Fatalf("Compile error: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := program.Run(); err != nil {
+			b.Fatalf("Run error: %v", err)
+		}
+	}
+}